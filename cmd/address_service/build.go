@@ -0,0 +1,205 @@
+package main
+
+import (
+	"AddressService/config"
+	HandKafka "AddressService/internal/domains/message/handler/kafka"
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/domains/message/repository/geocoder"
+	"AddressService/internal/domains/message/trigger"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildGeocoder собирает цепочку геокодеров и оборачивает её декораторами из конфига:
+// coalesce → chain(breaker(primary + квота на POST), breaker(fallback)..., coordinates)
+func buildGeocoder(cfg config.GeocoderConfig) (geocoder.ReverseGeocoder, error) {
+	// регулятор может собрать батч больше 100 — клиент не должен резать его обратно
+	maxBatch := 0
+	if cfg.Adaptive.Enabled {
+		maxBatch = cfg.Adaptive.MaxBatch
+	}
+
+	baseURLs := cfg.BaseURLs
+	if len(baseURLs) == 0 && cfg.BaseURL != "" {
+		baseURLs = []string{cfg.BaseURL}
+	}
+
+	limiter, err := buildRateLimiter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := geocoder.NewReverseGeocoder(geocoder.ProviderConfig{
+		Provider:  cfg.Provider,
+		BaseURLs:  baseURLs,
+		TimeoutMs: cfg.TimeoutMs,
+		MaxConns:  cfg.Workers,
+		MaxBatch:  maxBatch,
+		RateLimit: limiter,
+		Hedge: geocoder.HedgePolicy{
+			Enabled:    cfg.Hedge.Enabled,
+			Percentile: cfg.Hedge.Percentile,
+			MinDelay:   time.Duration(cfg.Hedge.MinDelayMs) * time.Millisecond,
+			MaxHedges:  cfg.Hedge.MaxHedges,
+		},
+		DatasetPath:  cfg.DatasetPath,
+		MaxDistanceM: cfg.OfflineMaxDistanceM,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	primary = withBreaker(primary, "primary", cfg.CircuitBreaker)
+
+	links := []geocoder.ReverseGeocoder{primary}
+	for i, fc := range cfg.Fallbacks {
+		timeoutMs := fc.TimeoutMs
+		if timeoutMs <= 0 {
+			timeoutMs = cfg.TimeoutMs
+		}
+		var fbURLs []string
+		if fc.BaseURL != "" {
+			fbURLs = []string{fc.BaseURL}
+		}
+		g, err := geocoder.NewReverseGeocoder(geocoder.ProviderConfig{
+			Provider:     fc.Provider,
+			BaseURLs:     fbURLs,
+			TimeoutMs:    timeoutMs,
+			MaxConns:     cfg.Workers,
+			MaxBatch:     maxBatch,
+			DatasetPath:  fc.DatasetPath,
+			MaxDistanceM: cfg.OfflineMaxDistanceM,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("geocoder.fallbacks[%d]: %w", i, err)
+		}
+		// координаты и офлайн-датасет считаются локально, ломаться там нечему
+		if fc.Provider != geocoder.ProviderCoordinates && fc.Provider != geocoder.ProviderOffline {
+			g = withBreaker(g, fmt.Sprintf("fallback_%d_%s", i, fc.Provider), cfg.CircuitBreaker)
+		}
+		links = append(links, g)
+	}
+
+	var geo geocoder.ReverseGeocoder = links[0]
+	if len(links) > 1 {
+		geo = geocoder.NewChain(links...)
+	}
+
+	if cfg.Coalesce.Enabled {
+		geo = geocoder.NewCoalescer(geo, cfg.Coalesce.Decimals)
+	}
+
+	return geo, nil
+}
+
+// buildRateLimiter — квота geocache; nil, если выключена.
+// Токены берёт каждый POST, так что burst должен вмещать самый крупный из них.
+func buildRateLimiter(cfg config.GeocoderConfig) (*geocoder.RateLimiter, error) {
+	rl := cfg.RateLimit
+	if !rl.Enabled {
+		return nil, nil
+	}
+	if cfg.Provider != "" && cfg.Provider != geocoder.ProviderGeocache {
+		log.Printf("⚠️ geocoder.rate_limit applies to geocache only, ignored for %q", cfg.Provider)
+		return nil, nil
+	}
+
+	postSize := 100
+	if cfg.Adaptive.Enabled {
+		postSize = cfg.Adaptive.MaxBatch
+	}
+	burst := rl.PositionsBurst
+	if rl.PositionsPerSec > 0 {
+		if burst == 0 {
+			burst = max(int(rl.PositionsPerSec), postSize)
+		}
+		if burst < postSize {
+			return nil, fmt.Errorf("geocoder.rate_limit.positions_burst %d is below the POST size %d", burst, postSize)
+		}
+	}
+
+	return geocoder.NewRateLimiter(geocoder.RateLimit{
+		PositionsPerSec: rl.PositionsPerSec,
+		PositionsBurst:  burst,
+		BatchesPerSec:   rl.BatchesPerSec,
+		BatchesBurst:    rl.BatchesBurst,
+		MaxWait:         time.Duration(rl.MaxWaitMs) * time.Millisecond,
+	}), nil
+}
+
+func withBreaker(g geocoder.ReverseGeocoder, name string, cfg config.CircuitBreakerConfig) geocoder.ReverseGeocoder {
+	if !cfg.Enabled {
+		return g
+	}
+	return geocoder.NewCircuitBreaker(g, name, cfg.FailureThreshold,
+		time.Duration(cfg.OpenTimeoutMs)*time.Millisecond, cfg.HalfOpenProbes)
+}
+
+// buildTenantLangs проверяет языки из конфига и приводит их к виду ключей кешей
+func buildTenantLangs(kafkaCfg config.KafkaConfig, cfg config.LangConfig) (HandKafka.TenantLangs, error) {
+	def, ok := model.NormalizeLang(cfg.Default)
+	if !ok {
+		return HandKafka.TenantLangs{}, fmt.Errorf("geocoder.lang.default: bad language %q", cfg.Default)
+	}
+
+	tenants := make(map[string]string, len(cfg.Tenants))
+	for tenant, lang := range cfg.Tenants {
+		l, ok := model.NormalizeLang(lang)
+		if !ok {
+			return HandKafka.TenantLangs{}, fmt.Errorf("geocoder.lang.tenants: bad language %q for %q", lang, tenant)
+		}
+		tenants[strings.ToLower(tenant)] = l
+	}
+
+	return HandKafka.TenantLangs{Header: kafkaCfg.TenantHeader, Default: def, Tenants: tenants}, nil
+}
+
+// buildTriggerProfiles переводит секцию trigger конфига в правила триггера
+func buildTriggerProfiles(cfg config.TriggerConfig) (*trigger.Profiles, error) {
+	groups := make(map[string]trigger.RuleOverride, len(cfg.Groups))
+	for name, rc := range cfg.Groups {
+		groups[name] = toRuleOverride(rc)
+	}
+
+	deviceGroups := make(map[int64]string, len(cfg.Devices))
+	for idStr, group := range cfg.Devices {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("trigger.devices: bad device id %q: %w", idStr, err)
+		}
+		if _, ok := groups[group]; !ok {
+			return nil, fmt.Errorf("trigger.devices: device %d refers to unknown group %q", id, group)
+		}
+		deviceGroups[id] = group
+	}
+
+	devices := make(map[int64]trigger.RuleOverride, len(cfg.Overrides))
+	for idStr, rc := range cfg.Overrides {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("trigger.overrides: bad device id %q: %w", idStr, err)
+		}
+		devices[id] = toRuleOverride(rc)
+	}
+
+	// у default незаданное — значит выключено
+	return trigger.NewProfiles(toRuleOverride(cfg.Default).Over(trigger.Rule{}), groups, deviceGroups, devices), nil
+}
+
+func toRuleOverride(rc config.TriggerRuleConfig) trigger.RuleOverride {
+	o := trigger.RuleOverride{
+		SpeedBands: make([]trigger.SpeedBand, 0, len(rc.SpeedBands)),
+	}
+	for _, b := range rc.SpeedBands {
+		o.SpeedBands = append(o.SpeedBands, trigger.SpeedBand{MinSpeed: b.MinSpeed, DistanceM: b.DistanceM})
+	}
+	if rc.MaxStalenessS != nil {
+		staleness := time.Duration(*rc.MaxStalenessS) * time.Second
+		o.MaxStaleness = &staleness
+	}
+	o.HeadingChangeDeg = rc.HeadingChangeDeg
+	return o
+}
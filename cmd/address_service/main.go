@@ -2,17 +2,23 @@ package main
 
 import (
 	"AddressService/config"
+	"AddressService/internal/domains/message/cache"
 	"AddressService/internal/domains/message/handler/http"
 	HandKafka "AddressService/internal/domains/message/handler/kafka"
-	"AddressService/internal/domains/message/repository/geocoder"
 	ProdKafka "AddressService/internal/domains/message/repository/kafka"
 	"AddressService/internal/domains/message/trigger"
 	"AddressService/internal/domains/message/usecase"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	kafkago "github.com/segmentio/kafka-go"
 	"log"
+	nethttp "net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -24,17 +30,74 @@ func main() {
 
 	gin.SetMode(gin.ReleaseMode)
 
-	producer := ProdKafka.NewKafkaProducer(cfg.Kafka.Brokers, cfg.Kafka.EnrichedTopic)
+	keys, err := ProdKafka.ParseKeyStrategy(cfg.Kafka.KeyStrategy)
+	if err != nil {
+		log.Fatalf("Invalid kafka config: %v", err)
+	}
+	producer := ProdKafka.NewKafkaProducer(cfg.Kafka.Brokers, cfg.Kafka.EnrichedTopic, keys)
+
+	geo, err := buildGeocoder(cfg.Geocoder)
+	if err != nil {
+		log.Fatalf("Failed to create geocoder: %v", err)
+	}
+
+	langs, err := buildTenantLangs(cfg.Kafka, cfg.Geocoder.Lang)
+	if err != nil {
+		log.Fatalf("Failed to load languages: %v", err)
+	}
 
-	geo := geocoder.New(cfg.Geocoder.BaseURL, cfg.Geocoder.TimeoutMs, cfg.Geocoder.Workers)
+	profiles, err := buildTriggerProfiles(cfg.Trigger)
+	if err != nil {
+		log.Fatalf("Failed to build trigger profiles: %v", err)
+	}
+	addressTrigger := trigger.NewAddressTrigger(profiles, trigger.Eviction{
+		MaxDevices:    cfg.Trigger.MaxDevices,
+		TTL:           time.Duration(cfg.Trigger.TTLS) * time.Second,
+		SweepInterval: time.Duration(cfg.Trigger.SweepIntervalS) * time.Second,
+	}, cfg.Trigger.Shards)
+	defer addressTrigger.Close()
 
-	addressTrigger := trigger.NewAddressTrigger()
-	messageUC := usecase.NewMessageUseCase(addressTrigger, producer, geo)
+	// кеш устройств поднимаем до старта консьюмера, иначе после деплоя геокодим всех заново
+	if path := cfg.Trigger.SnapshotPath; path != "" {
+		n, err := addressTrigger.LoadFile(path)
+		if err != nil {
+			log.Printf("⚠️ trigger snapshot %s not restored: %v", path, err)
+		} else {
+			log.Printf("trigger: restored %d devices from %s", n, path)
+		}
+		addressTrigger.StartSnapshots(path, time.Duration(cfg.Trigger.SnapshotIntervalS)*time.Second)
+	}
+	var spatial *cache.GridCache
+	if cfg.Spatial.Enabled {
+		spatial = cache.NewGridCache(cfg.Spatial.Precision, time.Duration(cfg.Spatial.TTLS)*time.Second, cfg.Spatial.MaxEntries)
+	}
+
+	messageUC := usecase.NewMessageUseCase(addressTrigger, producer, geo, spatial, usecase.RetryPolicy{
+		MaxAttempts: cfg.Geocoder.Retry.MaxAttempts,
+		BaseBackoff: time.Duration(cfg.Geocoder.Retry.BaseBackoffMs) * time.Millisecond,
+		MaxBackoff:  time.Duration(cfg.Geocoder.Retry.MaxBackoffMs) * time.Millisecond,
+		MaxElapsed:  time.Duration(cfg.Geocoder.Retry.MaxElapsedMs) * time.Millisecond,
+	}, usecase.AdaptiveConfig{
+		Enabled:       cfg.Geocoder.Adaptive.Enabled,
+		MinBatch:      cfg.Geocoder.Adaptive.MinBatch,
+		MaxBatch:      cfg.Geocoder.Adaptive.MaxBatch,
+		BatchStep:     cfg.Geocoder.Adaptive.BatchStep,
+		MinParallel:   cfg.Geocoder.Adaptive.MinParallel,
+		MaxParallel:   cfg.Geocoder.Adaptive.MaxParallel,
+		TargetLatency: time.Duration(cfg.Geocoder.Adaptive.TargetLatencyMs) * time.Millisecond,
+		MaxErrorRate:  cfg.Geocoder.Adaptive.MaxErrorRate,
+		Interval:      time.Duration(cfg.Geocoder.Adaptive.IntervalMs) * time.Millisecond,
+	}, usecase.ReenrichPolicy{
+		Enabled:   cfg.Geocoder.Reenrich.Enabled,
+		Delay:     time.Duration(cfg.Geocoder.Reenrich.DelayMs) * time.Millisecond,
+		QueueSize: cfg.Geocoder.Reenrich.QueueSize,
+	})
 
 	r := gin.Default()
-	httpHandler := http.NewMessageHandler(messageUC)
+	httpHandler := http.NewMessageHandler(messageUC, langs.Default)
 	r.POST("/message", httpHandler.Handle)
 	r.POST("/report", httpHandler.HandleReport)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	reader := kafkago.NewReader(kafkago.ReaderConfig{
 		Brokers:        cfg.Kafka.Brokers,
@@ -47,12 +110,84 @@ func main() {
 		CommitInterval: 2 * time.Second,
 	})
 
+	var dlq ProdKafka.DeadLetterProducer
+	if cfg.Kafka.DLQTopic != "" {
+		dlq = ProdKafka.NewDeadLetterProducer(cfg.Kafka.Brokers, cfg.Kafka.DLQTopic)
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	log.Println("started")
-	kafkaConsumer := HandKafka.NewMessageConsumer(messageUC, reader, 200, 50000)
-	go kafkaConsumer.Consume(context.Background())
+	kafkaConsumer := HandKafka.NewMessageConsumer(messageUC, reader, dlq, langs, 200, 50000)
+
+	consumeCtx, cancelConsume := context.WithCancel(context.Background())
+	consumeDone := make(chan struct{})
+	go func() {
+		defer close(consumeDone)
+		if err := kafkaConsumer.Consume(consumeCtx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("❌ Consume stopped: %v", err)
+		}
+	}()
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("HTTP server failed: %v", err)
+	srv := &nethttp.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-sigCtx.Done()
+	stop()
+	log.Println("shutting down...")
+
+	timeout := time.Duration(cfg.Server.ShutdownTimeoutMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// 1. HTTP: новые запросы не принимаем, текущие дожидаемся
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("⚠️ HTTP shutdown: %v", err)
+		}
+
+		// 2. Kafka: перестаём читать raw и отдаём прочитанное в usecase
+		cancelConsume()
+		<-consumeDone
+		kafkaConsumer.Close()
+
+		// 3. полосы устройств → produceQueue → async writer
+		messageUC.Close()
+
+		if path := cfg.Trigger.SnapshotPath; path != "" {
+			if n, err := addressTrigger.SaveFile(path); err != nil {
+				log.Printf("⚠️ trigger snapshot: %v", err)
+			} else {
+				log.Printf("trigger: saved %d devices to %s", n, path)
+			}
+		}
+
+		// 4. всё подтверждённое продюсером коммитим и закрываем reader
+		if err := kafkaConsumer.CommitPending(ctx); err != nil {
+			log.Printf("⚠️ final commit: %v", err)
+		}
+		if err := reader.Close(); err != nil {
+			log.Printf("⚠️ reader close: %v", err)
+		}
+		if dlq != nil {
+			_ = dlq.Close()
+		}
+	}()
+
+	select {
+	case <-done:
+		log.Println("stopped")
+	case <-ctx.Done():
+		log.Printf("⚠️ shutdown deadline %s exceeded, exiting", timeout)
+		os.Exit(1)
 	}
 }
@@ -10,11 +10,22 @@ type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
 	Kafka    KafkaConfig    `mapstructure:"kafka"`
 	Geocoder GeocoderConfig `mapstructure:"geocoder"`
+	Trigger  TriggerConfig  `mapstructure:"trigger"`
+	Spatial  SpatialConfig  `mapstructure:"spatial_cache"`
+}
+
+// SpatialConfig — общий кеш адресов по geohash-ячейкам
+type SpatialConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	Precision  int  `mapstructure:"precision"` // длина geohash: 7 ≈ 150 м, 8 ≈ 38×19 м
+	TTLS       int  `mapstructure:"ttl_s"`
+	MaxEntries int  `mapstructure:"max_entries"`
 }
 
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port              int    `mapstructure:"port"`
+	Host              string `mapstructure:"host"`
+	ShutdownTimeoutMs int    `mapstructure:"shutdown_timeout_ms"` // сколько ждём дренаж при остановке
 }
 
 type KafkaConfig struct {
@@ -22,12 +33,139 @@ type KafkaConfig struct {
 	RawTopic      string   `mapstructure:"raw_topic"`
 	EnrichedTopic string   `mapstructure:"enriched_topic"`
 	GroupID       string   `mapstructure:"group_id"`
+	DLQTopic      string   `mapstructure:"dlq_topic"`     // пусто — DLQ выключен, недоставленное списывается после повторов
+	TenantHeader  string   `mapstructure:"tenant_header"` // заголовок с тенантом для geocoder.lang.tenants
+	KeyStrategy   string   `mapstructure:"key_strategy"`  // ключ обогащённых: device_id | none
 }
 
 type GeocoderConfig struct {
-	BaseURL   string `mapstructure:"base_url"`
-	TimeoutMs int    `mapstructure:"timeout_ms"`
-	Workers   int    `mapstructure:"workers"`
+	Provider  string   `mapstructure:"provider"`  // geocache | nominatim | offline
+	BaseURL   string   `mapstructure:"base_url"`  // устарело: одна реплика, если base_urls пуст
+	BaseURLs  []string `mapstructure:"base_urls"` // реплики geocache, запросы идут по кругу
+	TimeoutMs int      `mapstructure:"timeout_ms"`
+	Workers   int      `mapstructure:"workers"`
+
+	Hedge HedgeConfig `mapstructure:"hedge"`
+
+	// offline: GeoJSON (границы + улицы) или CSV именованных точек, грузится в память
+	DatasetPath         string  `mapstructure:"dataset_path"`
+	OfflineMaxDistanceM float64 `mapstructure:"offline_max_distance_m"`
+
+	Lang           LangConfig           `mapstructure:"lang"`
+	Retry          RetryConfig          `mapstructure:"retry"`
+	Adaptive       AdaptiveConfig       `mapstructure:"adaptive"`
+	RateLimit      RateLimitConfig      `mapstructure:"rate_limit"`
+	Reenrich       ReenrichConfig       `mapstructure:"reenrich"`
+	Coalesce       CoalesceConfig       `mapstructure:"coalesce"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+
+	// Запасные бэкенды по порядку, если основной недоступен.
+	// provider: coordinates — адрес в виде "lat, lon", всегда отвечает.
+	// provider: offline — локальный датасет из dataset_path, без сети.
+	Fallbacks []FallbackConfig `mapstructure:"fallbacks"`
+}
+
+// HedgeConfig — дубль медленного батча на следующую реплику из base_urls
+type HedgeConfig struct {
+	Enabled    bool    `mapstructure:"enabled"`
+	Percentile float64 `mapstructure:"percentile"`   // 0.95 — дубль, если ждём дольше p95
+	MinDelayMs int     `mapstructure:"min_delay_ms"` // но не раньше этого
+	MaxHedges  int     `mapstructure:"max_hedges"`   // дублей на батч
+}
+
+// LangConfig — язык адресов по умолчанию. HTTP переопределяет его через ?lang=.
+type LangConfig struct {
+	Default string            `mapstructure:"default"` // пусто — язык геокодера
+	Tenants map[string]string `mapstructure:"tenants"` // тенант из kafka.tenant_header → язык
+}
+
+// CircuitBreakerConfig — общий для основного и запасных бэкендов
+type CircuitBreakerConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	FailureThreshold int  `mapstructure:"failure_threshold"` // ошибок подряд до открытия
+	OpenTimeoutMs    int  `mapstructure:"open_timeout_ms"`   // сколько не ходим в бэкенд
+	HalfOpenProbes   int  `mapstructure:"half_open_probes"`  // пробных запросов после паузы
+}
+
+type FallbackConfig struct {
+	Provider    string `mapstructure:"provider"`
+	BaseURL     string `mapstructure:"base_url"`
+	TimeoutMs   int    `mapstructure:"timeout_ms"`
+	DatasetPath string `mapstructure:"dataset_path"`
+}
+
+// ReenrichConfig — повторно геокодировать сообщения, ушедшие как skipped_overload
+type ReenrichConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	DelayMs   int  `mapstructure:"delay_ms"`
+	QueueSize int  `mapstructure:"queue_size"`
+}
+
+// RateLimitConfig — клиентская квота на основной геокодер (token bucket).
+// Не уложились в max_wait — сообщения уходят с прошлым адресом, /report отвечает 429.
+type RateLimitConfig struct {
+	Enabled         bool    `mapstructure:"enabled"`
+	PositionsPerSec float64 `mapstructure:"positions_per_s"` // 0 — без ограничения
+	PositionsBurst  int     `mapstructure:"positions_burst"` // не меньше позиций в одном POST; 0 — max(positions_per_s, POST)
+	BatchesPerSec   float64 `mapstructure:"batches_per_s"`   // POST в секунду, с дублями хеджа; 0 — без ограничения
+	BatchesBurst    int     `mapstructure:"batches_burst"`
+	MaxWaitMs       int     `mapstructure:"max_wait_ms"`
+}
+
+// AdaptiveConfig — AIMD-подстройка размера батча и числа батчей в полёте
+type AdaptiveConfig struct {
+	Enabled         bool    `mapstructure:"enabled"`
+	MinBatch        int     `mapstructure:"min_batch"`
+	MaxBatch        int     `mapstructure:"max_batch"`
+	BatchStep       int     `mapstructure:"batch_step"` // прирост батча за удачное окно
+	MinParallel     int     `mapstructure:"min_parallel"`
+	MaxParallel     int     `mapstructure:"max_parallel"`
+	TargetLatencyMs int     `mapstructure:"target_latency_ms"` // выше — режем вдвое
+	MaxErrorRate    float64 `mapstructure:"max_error_rate"`    // доля упавших батчей, выше — режем вдвое
+	IntervalMs      int     `mapstructure:"interval_ms"`       // окно, по которому принимается решение
+}
+
+// CoalesceConfig — схлопывание одинаковых позиций в батче и между воркерами
+type CoalesceConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	Decimals int  `mapstructure:"decimals"` // округление координат: 5 ≈ 1 м
+}
+
+type RetryConfig struct {
+	MaxAttempts   int `mapstructure:"max_attempts"`
+	BaseBackoffMs int `mapstructure:"base_backoff_ms"`
+	MaxBackoffMs  int `mapstructure:"max_backoff_ms"`
+	MaxElapsedMs  int `mapstructure:"max_elapsed_ms"` // все попытки батча в полосе Kafka-пути
+}
+
+// TriggerConfig — когда перезапрашивать адрес устройства.
+// Правила групп и устройств наследуют незаданные поля у default.
+type TriggerConfig struct {
+	Default   TriggerRuleConfig            `mapstructure:"default"`
+	Groups    map[string]TriggerRuleConfig `mapstructure:"groups"`    // имя группы → правило
+	Devices   map[string]string            `mapstructure:"devices"`   // ID устройства → группа
+	Overrides map[string]TriggerRuleConfig `mapstructure:"overrides"` // ID устройства → своё правило
+
+	MaxDevices     int `mapstructure:"max_devices"`      // 0 — без ограничения
+	TTLS           int `mapstructure:"ttl_s"`            // 0 — без TTL
+	SweepIntervalS int `mapstructure:"sweep_interval_s"` // период фоновой чистки
+	Shards         int `mapstructure:"shards"`           // число шардов кеша, степень двойки
+
+	SnapshotPath      string `mapstructure:"snapshot_path"`       // пусто — состояние не сохраняется
+	SnapshotIntervalS int    `mapstructure:"snapshot_interval_s"` // как часто писать снапшот
+}
+
+// TriggerRuleConfig — поля-указатели: не задано (nil) — наследуется у default,
+// явный 0 у группы или устройства выключает проверку
+type TriggerRuleConfig struct {
+	SpeedBands       []SpeedBandConfig `mapstructure:"speed_bands"`
+	MaxStalenessS    *int              `mapstructure:"max_staleness_s"`
+	HeadingChangeDeg *int              `mapstructure:"heading_change_deg"`
+}
+
+type SpeedBandConfig struct {
+	MinSpeed  int     `mapstructure:"min_speed"` // км/ч, включительно
+	DistanceM float64 `mapstructure:"distance_m"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -42,15 +180,74 @@ func LoadConfig() (*Config, error) {
 	// Defaults
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.host", "localhost")
+	v.SetDefault("server.shutdown_timeout_ms", 15000)
 
 	v.SetDefault("kafka.brokers", []string{"localhost:9092"})
 	v.SetDefault("kafka.raw_topic", "raw-topic")
 	v.SetDefault("kafka.enriched_topic", "enriched-topic")
 	v.SetDefault("kafka.group_id", "address-service-group")
+	v.SetDefault("kafka.dlq_topic", "")
+	v.SetDefault("kafka.tenant_header", "tenant")
+	v.SetDefault("kafka.key_strategy", "device_id")
 
+	v.SetDefault("geocoder.provider", "geocache")
 	v.SetDefault("geocoder.base_url", "http://localhost:8012")
+	v.SetDefault("geocoder.base_urls", []string{})
+	v.SetDefault("geocoder.hedge.enabled", false)
+	v.SetDefault("geocoder.hedge.percentile", 0.95)
+	v.SetDefault("geocoder.hedge.min_delay_ms", 50)
+	v.SetDefault("geocoder.hedge.max_hedges", 1)
 	v.SetDefault("geocoder.timeout_ms", 800)
 	v.SetDefault("geocoder.workers", 100)
+	v.SetDefault("geocoder.dataset_path", "")
+	v.SetDefault("geocoder.offline_max_distance_m", 200)
+	v.SetDefault("geocoder.lang.default", "")
+	v.SetDefault("geocoder.retry.max_attempts", 4)
+	v.SetDefault("geocoder.retry.base_backoff_ms", 200)
+	v.SetDefault("geocoder.retry.max_backoff_ms", 1000)
+	v.SetDefault("geocoder.retry.max_elapsed_ms", 3000)
+	v.SetDefault("geocoder.reenrich.enabled", false)
+	v.SetDefault("geocoder.reenrich.delay_ms", 30000)
+	v.SetDefault("geocoder.reenrich.queue_size", 10000)
+	v.SetDefault("geocoder.rate_limit.enabled", false)
+	v.SetDefault("geocoder.rate_limit.positions_per_s", 0)
+	v.SetDefault("geocoder.rate_limit.positions_burst", 0)
+	v.SetDefault("geocoder.rate_limit.batches_per_s", 0)
+	v.SetDefault("geocoder.rate_limit.batches_burst", 0)
+	v.SetDefault("geocoder.rate_limit.max_wait_ms", 200)
+	v.SetDefault("geocoder.adaptive.enabled", false)
+	v.SetDefault("geocoder.adaptive.min_batch", 20)
+	v.SetDefault("geocoder.adaptive.max_batch", 500)
+	v.SetDefault("geocoder.adaptive.batch_step", 10)
+	v.SetDefault("geocoder.adaptive.min_parallel", 2)
+	v.SetDefault("geocoder.adaptive.max_parallel", 32)
+	v.SetDefault("geocoder.adaptive.target_latency_ms", 300)
+	v.SetDefault("geocoder.adaptive.max_error_rate", 0.05)
+	v.SetDefault("geocoder.adaptive.interval_ms", 1000)
+	v.SetDefault("geocoder.coalesce.enabled", true)
+	v.SetDefault("geocoder.coalesce.decimals", 5)
+	v.SetDefault("geocoder.circuit_breaker.enabled", true)
+	v.SetDefault("geocoder.circuit_breaker.failure_threshold", 5)
+	v.SetDefault("geocoder.circuit_breaker.open_timeout_ms", 5000)
+	v.SetDefault("geocoder.circuit_breaker.half_open_probes", 1)
+
+	v.SetDefault("trigger.default.speed_bands", []map[string]interface{}{
+		{"min_speed": 0, "distance_m": 300},
+		{"min_speed": 81, "distance_m": 2000},
+	})
+	v.SetDefault("trigger.default.max_staleness_s", 0)
+	v.SetDefault("trigger.default.heading_change_deg", 0)
+	v.SetDefault("trigger.max_devices", 500000)
+	v.SetDefault("trigger.ttl_s", 86400)
+	v.SetDefault("trigger.sweep_interval_s", 60)
+	v.SetDefault("trigger.shards", 64)
+	v.SetDefault("trigger.snapshot_path", "")
+	v.SetDefault("trigger.snapshot_interval_s", 60)
+
+	v.SetDefault("spatial_cache.enabled", true)
+	v.SetDefault("spatial_cache.precision", 8)
+	v.SetDefault("spatial_cache.ttl_s", 86400)
+	v.SetDefault("spatial_cache.max_entries", 1000000)
 
 	if err := v.ReadInConfig(); err != nil {
 		fmt.Println("⚠️  Config file not found, using defaults and env")
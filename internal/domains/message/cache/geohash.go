@@ -0,0 +1,53 @@
+package cache
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash кодирует точку в geohash заданной точности (1..12 символов).
+// Точность 7 — ячейка ~150×150 м, 8 — ~38×19 м.
+func Geohash(lat, lon float64, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > 12 {
+		precision = 12
+	}
+
+	latMin, latMax := -90.0, 90.0
+	lonMin, lonMax := -180.0, 180.0
+
+	out := make([]byte, precision)
+	even := true // чётные биты — долгота
+	bit, ch := 0, 0
+
+	for i := 0; i < precision; {
+		if even {
+			mid := (lonMin + lonMax) / 2
+			if lon >= mid {
+				ch = ch<<1 | 1
+				lonMin = mid
+			} else {
+				ch <<= 1
+				lonMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				latMin = mid
+			} else {
+				ch <<= 1
+				latMax = mid
+			}
+		}
+		even = !even
+
+		bit++
+		if bit == 5 {
+			out[i] = geohashAlphabet[ch]
+			i++
+			bit, ch = 0, 0
+		}
+	}
+
+	return string(out)
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/lru"
+	"AddressService/internal/metrics"
+	"time"
+)
+
+// gridShards — на сколько независимых частей со своим локом делится кеш:
+// в него на каждом промахе триггера ходят все воркеры консьюмера
+const gridShards = 64
+
+// GridCache — общий для всех устройств кеш адресов по geohash-ячейке.
+// Машины на одной базе или улице получают адрес без лишнего вызова геокодера.
+// Ячейка хранится отдельно для каждого языка.
+type GridCache struct {
+	shards    [gridShards]*lru.Shard[string, *gridEntry] // ячейка всегда в одном шарде
+	precision int
+	ttl       time.Duration // 0 — без TTL
+}
+
+type gridEntry struct {
+	address   string
+	details   *model.AddressDetails
+	expiresAt time.Time
+}
+
+// NewGridCache — maxEntries общий на все шарды
+func NewGridCache(precision int, ttl time.Duration, maxEntries int) *GridCache {
+	perShard := lru.PerShard(maxEntries, gridShards)
+
+	c := &GridCache{
+		precision: precision,
+		ttl:       ttl,
+	}
+	for i := range c.shards {
+		c.shards[i] = lru.NewShard[string, *gridEntry](perShard)
+	}
+	return c
+}
+
+func (c *GridCache) key(pos model.Pos, lang string) string {
+	if lang == "" {
+		return Geohash(pos.Y, pos.X, c.precision)
+	}
+	return lang + ":" + Geohash(pos.Y, pos.X, c.precision)
+}
+
+// shardFor — FNV-1a по ключу ячейки
+func (c *GridCache) shardFor(k string) *lru.Shard[string, *gridEntry] {
+	h := uint32(2166136261)
+	for i := 0; i < len(k); i++ {
+		h ^= uint32(k[i])
+		h *= 16777619
+	}
+	return c.shards[h%gridShards]
+}
+
+// Get — адрес ячейки, в которую попадает pos, на языке lang.
+// Details общие для ячейки, а точка своя: расстояние до объекта и уверенность
+// геокодера к ней не относятся и обнуляются.
+func (c *GridCache) Get(pos model.Pos, lang string) (string, *model.AddressDetails, bool) {
+	k := c.key(pos, lang)
+	s := c.shardFor(k)
+	now := time.Now()
+
+	s.Lock()
+	e, ok := s.Get(k)
+	if ok && c.ttl > 0 && now.After(e.expiresAt) {
+		s.Remove(k)
+		ok = false
+	}
+	s.Unlock()
+
+	if !ok {
+		metrics.SpatialCacheRequests.WithLabelValues("miss").Inc()
+		return "", nil, false
+	}
+
+	metrics.SpatialCacheRequests.WithLabelValues("hit").Inc()
+	var details *model.AddressDetails
+	if e.details != nil {
+		d := *e.details
+		d.DistanceM = 0
+		d.Confidence = 0
+		details = &d
+	}
+	return e.address, details, true
+}
+
+// Put запоминает адрес для ячейки pos. Пустые адреса не кешируются.
+func (c *GridCache) Put(pos model.Pos, lang string, address string, details *model.AddressDetails) {
+	if address == "" {
+		return
+	}
+
+	k := c.key(pos, lang)
+	e := &gridEntry{address: address, details: details, expiresAt: time.Now().Add(c.ttl)}
+	s := c.shardFor(k)
+
+	s.Lock()
+	s.Put(k, e)
+	s.Unlock()
+}
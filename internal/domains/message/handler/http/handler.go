@@ -3,25 +3,56 @@ package http
 import (
 	"AddressService/internal/domains/message/model"
 	"AddressService/internal/domains/message/usecase"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 )
 
 type MessageHandler struct {
-	usecase usecase.MessageUseCase
+	usecase     usecase.MessageUseCase
+	defaultLang string // язык, если его нет ни в ?lang=, ни в сообщении
 }
 
-func NewMessageHandler(uc usecase.MessageUseCase) *MessageHandler {
-	return &MessageHandler{usecase: uc}
+func NewMessageHandler(uc usecase.MessageUseCase, defaultLang string) *MessageHandler {
+	return &MessageHandler{usecase: uc, defaultLang: defaultLang}
+}
+
+// requestLang — ?lang= запроса или язык по умолчанию
+func (h *MessageHandler) requestLang(c *gin.Context) (string, bool) {
+	v := c.Query("lang")
+	if v == "" {
+		return h.defaultLang, true
+	}
+	return model.NormalizeLang(v)
+}
+
+// applyLang проставляет язык сообщению; свой lang в теле важнее ?lang=
+func applyLang(msg *model.Message, lang string) bool {
+	if msg.Lang == "" {
+		msg.Lang = lang
+		return true
+	}
+	l, ok := model.NormalizeLang(msg.Lang)
+	msg.Lang = l
+	return ok
 }
 
 // 📥 Обработка одного сообщения (реалтайм)
+// ?lang=kk|ru|en — язык адреса.
 func (h *MessageHandler) Handle(c *gin.Context) {
 	var msg model.Message
 	if err := c.ShouldBindJSON(&msg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
 		return
 	}
+	msg.ResetEnrichment() // статус адреса ставит сервис, не клиент
+
+	lang, ok := h.requestLang(c)
+	if !ok || !applyLang(&msg, lang) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang"})
+		return
+	}
 
 	if err := h.usecase.ProcessMessage(c.Request.Context(), &msg); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "processing failed"})
@@ -32,6 +63,8 @@ func (h *MessageHandler) Handle(c *gin.Context) {
 }
 
 // 📥 Обработка массива сообщений для отчёта (/report)
+// Ответ в порядке запроса; ?sort=true — отсортировать по ID, затем по DT.
+// ?lang=kk|ru|en — язык адресов.
 func (h *MessageHandler) HandleReport(c *gin.Context) {
 	var msgs []*model.Message
 	if err := c.ShouldBindJSON(&msgs); err != nil {
@@ -39,7 +72,34 @@ func (h *MessageHandler) HandleReport(c *gin.Context) {
 		return
 	}
 
-	updated, err := h.usecase.ProcessMessages(c.Request.Context(), msgs)
+	lang, ok := h.requestLang(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang"})
+		return
+	}
+	for _, msg := range msgs {
+		if msg == nil || !applyLang(msg, lang) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lang"})
+			return
+		}
+		msg.ResetEnrichment()
+	}
+
+	var opts usecase.ReportOptions
+	if v := c.Query("sort"); v != "" {
+		sortByDevice, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort flag"})
+			return
+		}
+		opts.SortByDevice = sortByDevice
+	}
+
+	updated, err := h.usecase.ProcessMessages(c.Request.Context(), msgs, opts)
+	if errors.Is(err, usecase.ErrRateLimited) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "geocoder rate limit exceeded, retry later"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "report processing failed"})
 		return
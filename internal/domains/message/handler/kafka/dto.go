@@ -8,6 +8,7 @@ type MessageDTO struct {
 	ST     int64                  `json:"st"`
 	Pos    model.Pos              `json:"pos"`
 	Params map[string]interface{} `json:"p"`
+	Lang   string                 `json:"lang,omitempty"` // если пусто — язык тенанта
 }
 
 // Конвертация DTO → Model
@@ -18,5 +19,6 @@ func (dto *MessageDTO) ToModel() *model.Message {
 		ST:     dto.ST,
 		Pos:    dto.Pos,
 		Params: dto.Params,
+		Lang:   dto.Lang,
 	}
 }
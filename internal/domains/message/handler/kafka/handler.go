@@ -2,11 +2,13 @@ package kafka
 
 import (
 	"AddressService/internal/domains/message/model"
+	ProdKafka "AddressService/internal/domains/message/repository/kafka"
 	"AddressService/internal/domains/message/usecase"
+	"AddressService/internal/metrics"
 	"context"
 	"log"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -18,14 +20,44 @@ var json = jsoniter.ConfigFastest
 type MessageConsumer struct {
 	usecase     usecase.MessageUseCase
 	reader      *kafka.Reader
+	dlq         ProdKafka.DeadLetterProducer // nil — DLQ выключен
 	workerCount int
-	queue       chan model.Message
-	total       atomic.Int64
+	queues      []chan model.Message // у каждого воркера своя: устройство → LaneOf → воркер
+	offsets     *offsetTracker
+	langs       TenantLangs
 	batchSize   int
-	wg          sync.WaitGroup
+	maxPending  int // столько сырых сообщений в полёте — и чтение встаёт, пока коммит не догонит
+
+	// обогащённые не записались — сырое отдаётся в usecase заново, потом DLQ или списание
+	maxRedeliveries   int
+	redeliveryBackoff time.Duration
+	wg                sync.WaitGroup
+	closeOnce         sync.Once
+}
+
+// TenantLangs — язык адреса по умолчанию для сообщений из Kafka.
+// Тенант берётся из заголовка Header, язык — из Tenants, иначе Default.
+type TenantLangs struct {
+	Header  string            // пусто — всем Default
+	Default string            // пусто — язык геокодера по умолчанию
+	Tenants map[string]string // тенант в нижнем регистре (viper так хранит ключи) → язык
 }
 
-func NewMessageConsumer(uc usecase.MessageUseCase, reader *kafka.Reader, workers int, queueSize int) *MessageConsumer {
+func (t TenantLangs) resolve(km kafka.Message) string {
+	if t.Header != "" && len(t.Tenants) > 0 {
+		for _, h := range km.Headers {
+			if h.Key == t.Header {
+				if lang, ok := t.Tenants[strings.ToLower(string(h.Value))]; ok {
+					return lang
+				}
+				break
+			}
+		}
+	}
+	return t.Default
+}
+
+func NewMessageConsumer(uc usecase.MessageUseCase, reader *kafka.Reader, dlq ProdKafka.DeadLetterProducer, langs TenantLangs, workers int, queueSize int) *MessageConsumer {
 	if workers <= 0 {
 		workers = 200
 	}
@@ -36,81 +68,216 @@ func NewMessageConsumer(uc usecase.MessageUseCase, reader *kafka.Reader, workers
 	c := &MessageConsumer{
 		usecase:     uc,
 		reader:      reader,
+		dlq:         dlq,
 		workerCount: workers,
-		queue:       make(chan model.Message, queueSize),
+		queues:      make([]chan model.Message, workers),
+		offsets:     newOffsetTracker(),
+		langs:       langs,
 		batchSize:   500,
+		maxPending:  100_000,
+
+		maxRedeliveries:   3,
+		redeliveryBackoff: time.Second,
 	}
 
-	for i := 0; i < workers; i++ {
+	// queueSize — общий объём, делится между воркерами
+	perWorker := queueSize / workers
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	for i := range c.queues {
+		c.queues[i] = make(chan model.Message, perWorker)
 		c.wg.Add(1)
-		go c.worker()
+		go c.worker(c.queues[i])
 	}
 
 	return c
 }
 
-func (c *MessageConsumer) worker() {
+// worker обслуживает свою очередь по одному сообщению, поэтому сообщения
+// одного устройства уходят в usecase в порядке чтения из Kafka
+func (c *MessageConsumer) worker(queue chan model.Message) {
 	defer c.wg.Done()
-	for msg := range c.queue {
+	for msg := range queue {
 		if err := c.usecase.ProcessMessage(context.Background(), &msg); err != nil {
 			log.Printf("❌ worker: %v", err)
 		}
-		c.total.Add(1)
 	}
 }
 
+// Consume читает raw-топик, пока не отменят ctx. Очередь воркеров не закрывает —
+// это делает Close, когда чтение уже остановлено.
 func (c *MessageConsumer) Consume(ctx context.Context) error {
-	defer close(c.queue)
+	go c.commitLoop(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			c.redeliver()
+
+			if c.offsets.inFlight() >= c.maxPending {
+				// коммит застрял или продюсер не успевает — не копим оффсеты в памяти
+				log.Printf("⚠️ %d raw messages in flight, pausing fetch", c.maxPending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+
+			// батч не ждёт полных batchSize дольше секунды: на тихом топике
+			// прочитанное не должно висеть, а повторы — ждать новых сообщений
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Second)
 			batch := make([]kafka.Message, 0, c.batchSize)
 			for i := 0; i < c.batchSize; i++ {
-				m, err := c.reader.FetchMessage(ctx)
+				m, err := c.reader.FetchMessage(fetchCtx)
 				if err != nil {
 					if ctx.Err() != nil {
+						cancel()
 						return nil
 					}
-					log.Printf("❌ FetchMessage: %v", err)
+					if fetchCtx.Err() == nil {
+						log.Printf("❌ FetchMessage: %v", err)
+					}
 					break
 				}
 				batch = append(batch, m)
 			}
+			cancel()
 
 			if len(batch) == 0 {
 				continue
 			}
+			metrics.MessagesConsumed.Add(float64(len(batch)))
 
 			// 🧠 Decode batch без лишних аллокаций
 			for _, km := range batch {
 				var raw []MessageDTO
 				if err := json.Unmarshal(km.Value, &raw); err != nil {
+					metrics.DecodeErrors.Inc()
+					ack := c.offsets.trackUndecodable(km, err)
+					ack(c.deadLetter(ctx, km, err))
 					continue
 				}
-				for _, dto := range raw {
-					msg := dto.ToModel()
-					select {
-					case c.queue <- *msg:
-					default:
-						// бэкпрешер: блокируем на долю секунды, если очередь заполнена
-						time.Sleep(10 * time.Millisecond)
-						c.queue <- *msg
-					}
-				}
+
+				// оффсет уйдёт в коммит, когда продюсер подтвердит все len(raw) сообщений
+				metrics.MessagesDecoded.Add(float64(len(raw)))
+				c.dispatch(km, raw, c.offsets.track(km, len(raw)))
 			}
+		}
+	}
+}
+
+// dispatch раскладывает сообщения сырого km по очередям воркеров
+func (c *MessageConsumer) dispatch(km kafka.Message, raw []MessageDTO, ack model.AckFunc) {
+	tenantLang := c.langs.resolve(km)
+	source := &model.Source{Topic: km.Topic, Partition: km.Partition, Offset: km.Offset}
+	for _, dto := range raw {
+		msg := dto.ToModel()
+		msg.Ack = ack
+		msg.Source = source
+		if msg.Lang == "" {
+			msg.Lang = tenantLang
+		} else if l, ok := model.NormalizeLang(msg.Lang); ok {
+			msg.Lang = l
+		} else {
+			msg.Lang = tenantLang
+		}
+		queue := c.queues[model.LaneOf(msg.ID, len(c.queues))]
+		select {
+		case queue <- *msg:
+		default:
+			// бэкпрешер: блокируем на долю секунды, если очередь заполнена
+			time.Sleep(10 * time.Millisecond)
+			queue <- *msg
+		}
+	}
+}
 
-			// ✅ Commit одной пачкой
-			if err := c.reader.CommitMessages(ctx, batch...); err != nil {
+// redeliver снова отдаёт в usecase сырые сообщения, чьи обогащённые не записались.
+// Вызывается только из Consume — очереди воркеров пишет одна горутина.
+func (c *MessageConsumer) redeliver() {
+	for _, tm := range c.offsets.dueRedelivery(c.maxRedeliveries, c.redeliveryBackoff, time.Now()) {
+		var raw []MessageDTO
+		if err := json.Unmarshal(tm.msg.Value, &raw); err != nil {
+			// в первый раз раскодировалось — сюда не попадаем; на всякий случай не держим оффсет
+			c.offsets.rearm(tm, 1)(nil)
+			continue
+		}
+		log.Printf("🔁 redelivering p%d@%d", tm.msg.Partition, tm.msg.Offset)
+		metrics.Undelivered.WithLabelValues("redelivered").Inc()
+		c.dispatch(tm.msg, raw, c.offsets.rearm(tm, len(raw)))
+	}
+}
+
+// commitLoop периодически коммитит оффсеты, по которым всё уже доставлено
+func (c *MessageConsumer) commitLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.CommitPending(ctx); err != nil {
 				log.Printf("⚠️ Commit failed: %v", err)
 			}
 		}
 	}
 }
 
+// CommitPending коммитит оффсеты всех полностью подтверждённых сырых сообщений.
+// Сообщения, которые продюсер не записал и после всех повторов, уходят в DLQ;
+// без DLQ они списываются, чтобы одна ошибка записи не держала партицию вечно.
+// Если DLQ не принял — партиция ждёт следующего тика.
+func (c *MessageConsumer) CommitPending(ctx context.Context) error {
+	for _, dl := range c.offsets.deadLetters(c.maxRedeliveries) {
+		if c.dlq == nil {
+			log.Printf("❌ p%d@%d dropped, no DLQ configured: %v", dl.msg.Partition, dl.msg.Offset, dl.cause)
+			metrics.Undelivered.WithLabelValues("dropped").Inc()
+			c.offsets.resolve(dl.tm)
+			continue
+		}
+		if err := c.dlq.Send(ctx, dl.msg, dl.cause); err != nil {
+			log.Printf("❌ DLQ write p%d@%d: %v", dl.msg.Partition, dl.msg.Offset, err)
+			continue
+		}
+		metrics.Undelivered.WithLabelValues("dead_lettered").Inc()
+		c.offsets.resolve(dl.tm)
+	}
+
+	msgs := c.offsets.committable()
+	if len(msgs) == 0 {
+		return nil
+	}
+	return c.reader.CommitMessages(ctx, msgs...)
+}
+
+// deadLetter откладывает нераспознанный payload в DLQ вместо того, чтобы молча его потерять.
+// Ошибка записи в DLQ не даёт закоммитить оффсет.
+func (c *MessageConsumer) deadLetter(ctx context.Context, km kafka.Message, cause error) error {
+	log.Printf("⚠️ decode p%d@%d: %v", km.Partition, km.Offset, cause)
+	if c.dlq == nil {
+		return nil
+	}
+	if err := c.dlq.Send(ctx, km, cause); err != nil {
+		log.Printf("❌ DLQ write p%d@%d: %v", km.Partition, km.Offset, err)
+		return err
+	}
+	return nil
+}
+
+// Close закрывает очереди и ждёт, пока воркеры отдадут всё в usecase.
+// Вызывать после того, как Consume вернулся.
 func (c *MessageConsumer) Close() {
-	close(c.queue)
+	c.closeOnce.Do(func() {
+		for _, q := range c.queues {
+			close(q)
+		}
+	})
 	c.wg.Wait()
 }
@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/metrics"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker следит, какие сырые сообщения уже полностью доставлены в enriched-топик.
+// Оффсет партиции двигается только по непрерывному префиксу подтверждённых сообщений,
+// поэтому всё, что ещё в полёте, после рестарта будет прочитано заново (at-least-once).
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+	pending    int // сырых сообщений в полёте по всем партициям
+}
+
+type partitionOffsets struct {
+	pending []*trackedMessage // в порядке оффсетов
+}
+
+type trackedMessage struct {
+	msg       kafka.Message
+	remaining int   // сколько обогащённых сообщений ещё не подтверждено
+	err       error // ошибка доставки (продюсер или запись в DLQ) — оффсет держим
+	cause     error // с чем сообщение уходит в DLQ; nil — пока не туда
+	attempts  int   // сколько раз сообщение отдавали в usecase заново
+	failedAt  time.Time
+}
+
+// deadLetter — сообщение, которое пора отложить в DLQ
+type deadLetter struct {
+	tm    *trackedMessage
+	msg   kafka.Message
+	cause error
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+	}
+}
+
+// track регистрирует сырое сообщение, из которого получится derived обогащённых.
+// Возвращённый AckFunc нужно вызвать ровно derived раз.
+func (t *offsetTracker) track(km kafka.Message, derived int) model.AckFunc {
+	return t.add(&trackedMessage{msg: km, remaining: derived})
+}
+
+// trackUndecodable регистрирует сообщение, которое сразу уходит в DLQ с причиной cause.
+// AckFunc вызывается один раз — с результатом записи в DLQ; при ошибке запись
+// повторит CommitPending, и в DLQ всё равно уйдёт cause, а не ошибка записи.
+func (t *offsetTracker) trackUndecodable(km kafka.Message, cause error) model.AckFunc {
+	return t.add(&trackedMessage{msg: km, remaining: 1, cause: cause})
+}
+
+func (t *offsetTracker) add(tm *trackedMessage) model.AckFunc {
+	t.mu.Lock()
+	p, ok := t.partitions[tm.msg.Partition]
+	if !ok {
+		p = &partitionOffsets{}
+		t.partitions[tm.msg.Partition] = p
+	}
+	p.pending = append(p.pending, tm)
+	t.pending++
+	t.mu.Unlock()
+
+	return t.ackFor(tm)
+}
+
+func (t *offsetTracker) ackFor(tm *trackedMessage) model.AckFunc {
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		tm.remaining--
+		if err != nil && tm.err == nil {
+			tm.err = err
+			tm.failedAt = time.Now()
+			log.Printf("❌ p%d@%d not delivered, holding commit: %v", tm.msg.Partition, tm.msg.Offset, err)
+		}
+	}
+}
+
+// inFlight — сколько сырых сообщений ещё не закоммичено
+func (t *offsetTracker) inFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pending
+}
+
+// failedHeads перебирает полностью подтверждённые сообщения с ошибкой доставки
+// в той части партиций, до которой может дойти коммит. Вызывать под t.mu.
+func (t *offsetTracker) failedHeads(fn func(tm *trackedMessage)) {
+	for _, p := range t.partitions {
+		for _, tm := range p.pending {
+			if tm.remaining > 0 {
+				break // дальше коммит всё равно не продвинется
+			}
+			if tm.err != nil {
+				fn(tm)
+			}
+		}
+	}
+}
+
+// dueRedelivery забирает сообщения, чьи обогащённые не записались, для повторной
+// отдачи в usecase: не больше maxAttempts раз, с паузой backoff, удваивающейся
+// с каждой попыткой. Забранное держит коммит, пока его не вооружат через rearm.
+func (t *offsetTracker) dueRedelivery(maxAttempts int, backoff time.Duration, now time.Time) []*trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []*trackedMessage
+	t.failedHeads(func(tm *trackedMessage) {
+		if tm.cause != nil || tm.attempts >= maxAttempts || now.Sub(tm.failedAt) < backoff<<tm.attempts {
+			return
+		}
+		tm.err = nil
+		tm.remaining = 1 // держим оффсет до rearm
+		tm.attempts++
+		out = append(out, tm)
+	})
+	return out
+}
+
+// rearm — забранное сообщение снова раскодировано, из него получится derived обогащённых
+func (t *offsetTracker) rearm(tm *trackedMessage, derived int) model.AckFunc {
+	t.mu.Lock()
+	tm.remaining = derived
+	t.mu.Unlock()
+
+	return t.ackFor(tm)
+}
+
+// deadLetters — сообщения, которые пора отложить в DLQ: нераскодированные
+// и те, чьи обогащённые не записались и после maxAttempts повторов
+func (t *offsetTracker) deadLetters(maxAttempts int) []deadLetter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []deadLetter
+	t.failedHeads(func(tm *trackedMessage) {
+		if tm.cause == nil {
+			if tm.attempts < maxAttempts {
+				return
+			}
+			// причина фиксируется один раз: ошибка записи в DLQ её не подменит
+			tm.cause = fmt.Errorf("enriched messages not delivered after %d redeliveries: %w", tm.attempts, tm.err)
+		}
+		out = append(out, deadLetter{tm: tm, msg: tm.msg, cause: tm.cause})
+	})
+	return out
+}
+
+// resolve снимает ошибку: сообщение отложено в DLQ (или списано), оффсет можно коммитить
+func (t *offsetTracker) resolve(tm *trackedMessage) {
+	t.mu.Lock()
+	tm.err = nil
+	t.mu.Unlock()
+}
+
+// committable снимает с головы каждой партиции подтверждённые сообщения
+// и возвращает последнее из них — его оффсет и коммитим.
+// Заодно обновляет метрики: сколько висит в полёте и какие партиции застряли.
+func (t *offsetTracker) committable() []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []kafka.Message
+	for partition, p := range t.partitions {
+		n := 0
+		for n < len(p.pending) && p.pending[n].remaining <= 0 && p.pending[n].err == nil {
+			n++
+		}
+		if n > 0 {
+			out = append(out, p.pending[n-1].msg)
+			p.pending = p.pending[n:]
+			t.pending -= n
+		}
+
+		label := strconv.Itoa(partition)
+		metrics.OffsetsPending.WithLabelValues(label).Set(float64(len(p.pending)))
+		stuck := 0.0
+		if len(p.pending) > 0 && p.pending[0].err != nil {
+			stuck = 1
+		}
+		metrics.CommitStuck.WithLabelValues(label).Set(stuck)
+	}
+
+	return out
+}
@@ -0,0 +1,16 @@
+package model
+
+// DeviceHash — Фибоначчиево хеширование ID устройства: соседние ID расходятся.
+// На нём держатся и шарды триггера, и полосы пайплайна.
+func DeviceHash(id int64) uint64 {
+	return uint64(id) * 11400714819323198485 >> 32
+}
+
+// LaneOf выбирает полосу (воркер, очередь) для устройства. Все сообщения
+// одного ID всегда попадают в одну полосу — так сохраняется их порядок.
+func LaneOf(id int64, lanes int) int {
+	if lanes <= 1 {
+		return 0
+	}
+	return int(DeviceHash(id) % uint64(lanes))
+}
@@ -0,0 +1,19 @@
+package model
+
+import "strings"
+
+// NormalizeLang приводит код языка к виду, в котором он попадает в ключи кешей:
+// "RU", " ru " → "ru", "en_US" → "en-us". false — код не похож на язык.
+func NormalizeLang(lang string) (string, bool) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	lang = strings.ReplaceAll(lang, "_", "-")
+	if len(lang) > 16 {
+		return "", false
+	}
+	for _, r := range lang {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return "", false
+		}
+	}
+	return lang, true
+}
@@ -9,6 +9,44 @@ type Pos struct {
 	Sl int     `json:"sl" bson:"sl"` // Satellites
 }
 
+// AddressComponents — части адреса по отдельности
+type AddressComponents struct {
+	Country     string `json:"country,omitempty" bson:"country,omitempty"`
+	Region      string `json:"region,omitempty" bson:"region,omitempty"`
+	City        string `json:"city,omitempty" bson:"city,omitempty"`
+	Street      string `json:"street,omitempty" bson:"street,omitempty"`
+	HouseNumber string `json:"house_number,omitempty" bson:"house_number,omitempty"`
+	Postcode    string `json:"postcode,omitempty" bson:"postcode,omitempty"`
+}
+
+// AddressDetails — структурированный адрес; есть только если геокодер вернул объект
+type AddressDetails struct {
+	Components AddressComponents `json:"components" bson:"components"`
+	PlaceID    string            `json:"place_id,omitempty" bson:"place_id,omitempty"`     // ID объекта у провайдера
+	DistanceM  float64           `json:"distance_m,omitempty" bson:"distance_m,omitempty"` // от точки до найденного объекта
+	Confidence float64           `json:"confidence,omitempty" bson:"confidence,omitempty"` // 0..1
+}
+
+// Enrichment — откуда у сообщения адрес
+const (
+	EnrichmentFresh           = "fresh"            // только что от геокодера
+	EnrichmentCached          = "cached"           // из кеша устройства или ячейки, актуален для этой точки
+	EnrichmentSkippedOverload = "skipped_overload" // геокодер пропущен из-за перегрузки, адрес прошлый (или пустой)
+	EnrichmentFailed          = "failed"           // геокодер не ответил после всех повторов, адреса нет
+	EnrichmentCoordinates     = "coordinates"      // все геокодеры отказали, вместо адреса — "lat, lon" из fallback
+)
+
+// Source — откуда сообщение пришло в raw-топике; уходит в заголовки обогащённого
+type Source struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// AckFunc вызывается продюсером ровно один раз, когда Kafka подтвердила
+// (или окончательно отвергла) обогащённое сообщение
+type AckFunc func(err error)
+
 type Message struct {
 	ID int64 `json:"id"`           // Internal object ID
 	DT int64 `json:"dt" bson:"dt"` // Device Time
@@ -18,5 +56,40 @@ type Message struct {
 	Params  map[string]interface{} `json:"p" bson:"p"`
 	Address string                 `json:"address" bson:"address"`
 
+	AddressDetails *AddressDetails `json:"address_details,omitempty" bson:"address_details,omitempty"`
+
+	// Язык адреса (kk, ru, en...); пусто — язык геокодера по умолчанию
+	Lang string `json:"lang,omitempty" bson:"lang,omitempty"`
+
+	// Геокодер так и не ответил после всех повторов — адрес пустой
+	AddressError bool `json:"address_error,omitempty" bson:"address_error,omitempty"`
+
+	// Enrichment — fresh | cached | skipped_overload | failed | coordinates (см. константы выше)
+	Enrichment string `json:"enrichment,omitempty" bson:"enrichment,omitempty"`
+
+	// Повторная публикация сообщения, ранее ушедшего со статусом skipped_overload
+	Reenriched bool `json:"reenriched,omitempty" bson:"reenriched,omitempty"`
+
+	// Подтверждение для исходного сообщения из raw-топика; nil для HTTP
+	Ack AckFunc `json:"-" bson:"-"`
+
+	// Координаты исходного сообщения в raw-топике; nil для HTTP
+	Source *Source `json:"-" bson:"-"`
+
+	// Какой бэкенд геокодера дал адрес (geocache, nominatim, offline...); пусто — не геокодер
+	Provider string `json:"-" bson:"-"`
+
 	//T time.Time `json:"t" bson:"-"` // Время отправки в ISO 8601 формате (RFC 3339 с миллисекундами)
 }
+
+// ResetEnrichment стирает всё, что проставляет сервис. Клиент HTTP присылает
+// Message целиком, и его enrichment или reenriched иначе дошли бы до выхода
+// (или увели бы сообщение мимо геокодера).
+func (m *Message) ResetEnrichment() {
+	m.Address = ""
+	m.AddressDetails = nil
+	m.AddressError = false
+	m.Enrichment = ""
+	m.Reenriched = false
+	m.Provider = ""
+}
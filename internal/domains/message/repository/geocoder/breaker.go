@@ -0,0 +1,151 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/metrics"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen — бэкенд признан недоступным, запрос даже не отправлялся
+var ErrCircuitOpen = errors.New("geocoder circuit open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+)
+
+// CircuitBreaker — декоратор: после FailureThreshold ошибок подряд перестаёт ходить
+// в бэкенд на OpenTimeout, затем пускает HalfOpenProbes пробных запросов.
+// Все пробы успешны — снова закрыт, любая ошибка — снова открыт.
+type CircuitBreaker struct {
+	next             ReverseGeocoder
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenProbes   int
+
+	mu             sync.Mutex
+	state          breakerState
+	failures       int
+	openedAt       time.Time
+	probesInFlight int
+	probeSuccesses int
+}
+
+func NewCircuitBreaker(next ReverseGeocoder, name string, failureThreshold int, openTimeout time.Duration, halfOpenProbes int) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	if openTimeout <= 0 {
+		openTimeout = 5 * time.Second
+	}
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = 1
+	}
+
+	b := &CircuitBreaker{
+		next:             next,
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		halfOpenProbes:   halfOpenProbes,
+	}
+	metrics.GeocoderCircuitState.WithLabelValues(name).Set(float64(stateClosed))
+
+	return b
+}
+
+func (b *CircuitBreaker) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := Lookup(ctx, b.next, positions, lang)
+	b.onResult(err)
+
+	return res, err
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(stateHalfOpen)
+		b.probesInFlight, b.probeSuccesses = 0, 0
+		fallthrough
+
+	case stateHalfOpen:
+		if b.probesInFlight >= b.halfOpenProbes {
+			return false
+		}
+		b.probesInFlight++
+		return true
+
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) onResult(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// квота — не поломка бэкенда: запрос не ушёл, ни успехом, ни ошибкой не считаем
+	limited := errors.Is(err, ErrRateLimited)
+
+	switch b.state {
+	case stateHalfOpen:
+		b.probesInFlight--
+		if limited {
+			return
+		}
+		if err != nil {
+			b.trip()
+			return
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.halfOpenProbes {
+			b.failures = 0
+			b.setState(stateClosed)
+		}
+
+	case stateClosed:
+		if limited {
+			return
+		}
+		if err == nil {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.trip()
+		}
+
+	default:
+		// ответ пришёл уже после открытия (запрос был в полёте) — ничего не меняем
+	}
+}
+
+// trip открывает цепь. Вызывать под b.mu.
+func (b *CircuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.setState(stateOpen)
+	println("⚠️ geocoder circuit open:", b.name)
+}
+
+func (b *CircuitBreaker) setState(s breakerState) {
+	b.state = s
+	metrics.GeocoderCircuitState.WithLabelValues(b.name).Set(float64(s))
+}
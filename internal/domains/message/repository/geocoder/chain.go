@@ -0,0 +1,98 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Chain — упорядоченная цепочка геокодеров: пробуем по очереди,
+// первый успешный ответ побеждает. Позиции, на которых ответивший бэкенд
+// вернул Result.Err, досылаются следующим звеньям.
+type Chain struct {
+	links []ReverseGeocoder
+}
+
+func NewChain(links ...ReverseGeocoder) *Chain {
+	return &Chain{links: links}
+}
+
+func (c *Chain) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	return c.resolve(ctx, 0, positions, lang)
+}
+
+// resolve спрашивает звенья начиная с from
+func (c *Chain) resolve(ctx context.Context, from int, positions []model.Pos, lang string) ([]Result, error) {
+	var lastErr error
+	for i := from; i < len(c.links); i++ {
+		res, err := Lookup(ctx, c.links[i], positions, lang)
+		if err == nil {
+			c.refill(ctx, i+1, positions, res, lang)
+			return res, nil
+		}
+		// квота — не поломка: запасные звенья не должны брать нагрузку на себя
+		if errors.Is(err, ErrRateLimited) {
+			return nil, err
+		}
+		lastErr = err
+
+		// открытый breaker — уже известное состояние, он сам залогирован и виден в метрике;
+		// иначе лог писался бы на каждый батч, пока цепь открыта
+		if i+1 < len(c.links) && !errors.Is(err, ErrCircuitOpen) {
+			println("⚠️ geocoder chain: link", i, "failed, falling back:", err.Error())
+		}
+	}
+
+	if lastErr == nil {
+		return nil, fmt.Errorf("geocoder chain is empty")
+	}
+	return nil, fmt.Errorf("all geocoders failed: %w", lastErr)
+}
+
+// refill досылает упавшие позиции следующим звеньям; не вышло — ошибка остаётся в Result.Err
+func (c *Chain) refill(ctx context.Context, from int, positions []model.Pos, res []Result, lang string) {
+	if from >= len(c.links) {
+		return
+	}
+
+	var idx []int
+	var retry []model.Pos
+	for j, r := range res {
+		if r.Err != nil {
+			idx = append(idx, j)
+			retry = append(retry, positions[j])
+		}
+	}
+	if len(idx) == 0 {
+		return
+	}
+
+	more, err := c.resolve(ctx, from, retry, lang)
+	if err != nil {
+		return
+	}
+	for k, j := range idx {
+		res[j] = more[k]
+	}
+}
+
+// Coordinates — последний рубеж: вместо адреса отдаёт координаты строкой.
+// Никогда не ошибается и не ходит в сеть.
+type Coordinates struct{}
+
+func NewCoordinates() *Coordinates {
+	return &Coordinates{}
+}
+
+func (Coordinates) GetAddresses(_ context.Context, positions []model.Pos, _ string) ([]Result, error) {
+	results := make([]Result, len(positions))
+	for i, p := range positions {
+		results[i] = Result{
+			Address:  strconv.FormatFloat(p.Y, 'f', 6, 64) + ", " + strconv.FormatFloat(p.X, 'f', 6, 64),
+			Provider: ProviderCoordinates,
+		}
+	}
+	return results, nil
+}
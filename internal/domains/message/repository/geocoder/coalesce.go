@@ -0,0 +1,116 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/metrics"
+	"context"
+	"math"
+	"sync"
+)
+
+// Coalescer — декоратор над ReverseGeocoder: одинаковые позиции внутри батча
+// уходят в геокодер один раз, а позиции, которые уже запрашивает другой воркер,
+// ждут его ответа (singleflight на уровне отдельных позиций).
+type Coalescer struct {
+	next  ReverseGeocoder
+	scale float64 // 10^decimals — до скольких знаков округляем координаты
+
+	mu       sync.Mutex
+	inflight map[coalesceKey]*flight
+}
+
+// coalesceKey — одна и та же точка на разных языках — разные запросы
+type coalesceKey struct {
+	lat, lon int64
+	lang     string
+}
+
+// flight — один запрос позиции в полёте; done закрывается, когда res/err готовы
+type flight struct {
+	done chan struct{}
+	res  Result
+	err  error
+}
+
+// NewCoalescer — decimals: 5 знаков ≈ 1 м, 4 ≈ 11 м
+func NewCoalescer(next ReverseGeocoder, decimals int) *Coalescer {
+	return &Coalescer{
+		next:     next,
+		scale:    math.Pow10(decimals),
+		inflight: make(map[coalesceKey]*flight),
+	}
+}
+
+func (c *Coalescer) key(p model.Pos, lang string) coalesceKey {
+	return coalesceKey{
+		lat:  int64(math.Round(p.Y * c.scale)),
+		lon:  int64(math.Round(p.X * c.scale)),
+		lang: lang,
+	}
+}
+
+func (c *Coalescer) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	keys := make([]coalesceKey, len(positions))
+	waits := make(map[coalesceKey]*flight, len(positions))
+
+	// позиции, которые запрашиваем мы сами
+	ownKeys := make([]coalesceKey, 0, len(positions))
+	ownPos := make([]model.Pos, 0, len(positions))
+
+	c.mu.Lock()
+	for i, p := range positions {
+		k := c.key(p, lang)
+		keys[i] = k
+		if _, ok := waits[k]; ok {
+			continue
+		}
+		if f, ok := c.inflight[k]; ok {
+			waits[k] = f
+			continue
+		}
+		f := &flight{done: make(chan struct{})}
+		c.inflight[k] = f
+		waits[k] = f
+		ownKeys = append(ownKeys, k)
+		ownPos = append(ownPos, p)
+	}
+	c.mu.Unlock()
+
+	if saved := len(positions) - len(ownPos); saved > 0 {
+		metrics.GeocoderCoalesced.Add(float64(saved))
+	}
+
+	// сначала свой запрос, потом ожидание чужих — так два воркера не ждут друг друга
+	if len(ownPos) > 0 {
+		res, err := Lookup(ctx, c.next, ownPos, lang)
+
+		c.mu.Lock()
+		for j, k := range ownKeys {
+			f := waits[k]
+			if err != nil {
+				f.err = err
+			} else {
+				f.res = res[j]
+			}
+			delete(c.inflight, k)
+			close(f.done)
+		}
+		c.mu.Unlock()
+	}
+
+	results := make([]Result, len(positions))
+	for i, k := range keys {
+		f := waits[k]
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+		results[i] = f.res
+	}
+
+	return results, nil
+}
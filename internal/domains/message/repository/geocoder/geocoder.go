@@ -6,6 +6,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -13,15 +15,50 @@ import (
 
 var json = jsoniter.ConfigFastest
 
+// ReverseGeocoder — общий контракт для всех бэкендов обратного геокодирования.
+// При err == nil результатов ровно len(positions), i-й относится к positions[i];
+// ошибка отдельной позиции — в Result.Err.
+// lang — язык адреса (kk, ru, en...); пусто — язык провайдера по умолчанию.
+type ReverseGeocoder interface {
+	GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error)
+}
+
+// Lookup вызывает g и проверяет контракт: ответ не той длины — ErrLengthMismatch.
+// Обёртки и вызывающие ходят в ReverseGeocoder только через него, чтобы
+// результаты раскладывались по позициям без своих проверок.
+func Lookup(ctx context.Context, g ReverseGeocoder, positions []model.Pos, lang string) ([]Result, error) {
+	res, err := g.GetAddresses(ctx, positions, lang)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != len(positions) {
+		return nil, fmt.Errorf("%w: sent %d positions, got %d results", ErrLengthMismatch, len(positions), len(res))
+	}
+	return res, nil
+}
+
+// Geocoder — HTTP-клиент geocache сервера (POST /reverse_batch).
+// Реплики из baseURLs чередуются по кругу; с хеджированием батч, не ответивший
+// к перцентилю латентности, дублируется на следующую реплику.
 type Geocoder struct {
-	baseURL string
-	client  *http.Client
-	batch   int
+	baseURLs []string
+	client   *http.Client
+	batch    int
+
+	hedge     HedgePolicy
+	limiter   *RateLimiter // nil — без квоты
+	latencies *latencyWindow
+	next      atomic.Uint64 // round-robin по репликам
 }
 
-func New(baseURL string, timeoutMs int, maxConns int) *Geocoder {
+// New — batch: сколько позиций уходит в один POST (<= 0 — 100).
+// Хеджирование работает, только если реплик больше одной; limiter может быть nil.
+func New(baseURLs []string, timeoutMs int, maxConns int, batch int, hedge HedgePolicy, limiter *RateLimiter) *Geocoder {
+	if batch <= 0 {
+		batch = 100
+	}
 	return &Geocoder{
-		baseURL: baseURL,
+		baseURLs: baseURLs,
 		client: &http.Client{
 			Timeout: time.Duration(timeoutMs) * time.Millisecond,
 			Transport: &http.Transport{
@@ -32,12 +69,19 @@ func New(baseURL string, timeoutMs int, maxConns int) *Geocoder {
 				ForceAttemptHTTP2:   true,
 			},
 		},
-		batch: 100,
+		batch:     batch,
+		hedge:     hedge.withDefaults(),
+		limiter:   limiter,
+		latencies: newLatencyWindow(latencyWindowSize),
 	}
 }
 
-func (g *Geocoder) GetAddresses(ctx context.Context, positions []model.Pos) ([]string, error) {
-	results := make([]string, 0, len(positions))
+func (g *Geocoder) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	if len(g.baseURLs) == 0 {
+		return nil, fmt.Errorf("geocache: no base_urls configured")
+	}
+
+	results := make([]Result, 0, len(positions))
 
 	for start := 0; start < len(positions); start += g.batch {
 		end := start + g.batch
@@ -46,7 +90,7 @@ func (g *Geocoder) GetAddresses(ctx context.Context, positions []model.Pos) ([]s
 		}
 
 		batch := positions[start:end]
-		addrs, err := g.getBatch(ctx, batch)
+		addrs, err := g.getBatch(ctx, batch, lang)
 		if err != nil {
 			return nil, fmt.Errorf("batch %d-%d failed: %w", start, end, err)
 		}
@@ -56,18 +100,42 @@ func (g *Geocoder) GetAddresses(ctx context.Context, positions []model.Pos) ([]s
 	return results, nil
 }
 
-func (g *Geocoder) getBatch(ctx context.Context, positions []model.Pos) ([]string, error) {
+func (g *Geocoder) getBatch(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
 	body, err := json.Marshal(positions)
 	if err != nil {
 		return nil, fmt.Errorf("marshal batch: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/reverse_batch", bytes.NewBuffer(body))
+	first := int(g.next.Add(1)-1) % len(g.baseURLs)
+	if g.hedge.Enabled && len(g.baseURLs) > 1 {
+		return g.getHedged(ctx, first, body, len(positions), lang)
+	}
+
+	return g.fetch(ctx, g.baseURLs[first], body, len(positions), lang)
+}
+
+// fetch — один POST на одну реплику; успешные ответы пополняют окно латентности.
+// Каждый POST, включая дубли хеджирования, сначала берёт токены квоты.
+func (g *Geocoder) fetch(ctx context.Context, baseURL string, body []byte, n int, lang string) ([]Result, error) {
+	if err := g.limiter.Wait(ctx, n); err != nil {
+		return nil, err
+	}
+
+	endpoint := baseURL + "/reverse_batch"
+	if lang != "" {
+		endpoint += "?lang=" + url.QueryEscape(lang)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create req: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
 
+	start := time.Now()
 	resp, err := g.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("do req: %w", err)
@@ -78,10 +146,17 @@ func (g *Geocoder) getBatch(ctx context.Context, positions []model.Pos) ([]strin
 		return nil, fmt.Errorf("geocache batch status %d", resp.StatusCode)
 	}
 
-	var addrs []string
-	if err := json.NewDecoder(resp.Body).Decode(&addrs); err != nil {
+	// элементы — строки (старый формат) или объекты со структурой адреса
+	var items []jsoniter.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
 		return nil, fmt.Errorf("decode resp: %w", err)
 	}
 
-	return addrs, nil
+	results, err := placeGeocacheItems(n, items)
+	if err != nil {
+		return nil, err
+	}
+	g.latencies.add(time.Since(start))
+
+	return results, nil
 }
@@ -0,0 +1,159 @@
+package geocoder
+
+import (
+	"AddressService/internal/metrics"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy — когда дублировать медленный батч на другую реплику
+type HedgePolicy struct {
+	Enabled    bool
+	Percentile float64       // 0.95 — ждём дольше, чем 95% недавних ответов, и хеджируем
+	MinDelay   time.Duration // не раньше: при малой выборке или очень быстрых ответах
+	MaxHedges  int           // сколько дублей на батч, не больше числа реплик - 1
+}
+
+func (p HedgePolicy) withDefaults() HedgePolicy {
+	if p.Percentile <= 0 || p.Percentile >= 1 {
+		p.Percentile = 0.95
+	}
+	if p.MinDelay <= 0 {
+		p.MinDelay = 50 * time.Millisecond
+	}
+	if p.MaxHedges <= 0 {
+		p.MaxHedges = 1
+	}
+	return p
+}
+
+// сколько последних ответов учитывается в перцентиле
+const (
+	latencyWindowSize = 512
+	minHedgeSamples   = 20 // меньше — хеджируем по MinDelay
+)
+
+// attemptResult — ответ одной реплики
+type attemptResult struct {
+	res    []Result
+	err    error
+	hedged bool
+}
+
+// getHedged отправляет батч на реплику first, а если она не ответила к перцентилю
+// (или уже упала) — дубль на следующую. Побеждает первый успешный ответ,
+// остальные запросы отменяются.
+func (g *Geocoder) getHedged(ctx context.Context, first int, body []byte, n int, lang string) ([]Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxAttempts := g.hedge.MaxHedges + 1
+	if maxAttempts > len(g.baseURLs) {
+		maxAttempts = len(g.baseURLs)
+	}
+
+	// буфер на все попытки: проигравшие не блокируются после нашего выхода
+	results := make(chan attemptResult, maxAttempts)
+	launched := 0
+	launch := func() {
+		target := g.baseURLs[(first+launched)%len(g.baseURLs)]
+		hedged := launched > 0
+		launched++
+		if hedged {
+			metrics.GeocoderHedges.WithLabelValues("sent").Inc()
+		}
+		go func() {
+			res, err := g.fetch(ctx, target, body, n, lang)
+			results <- attemptResult{res: res, err: err, hedged: hedged}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(g.hedgeDelay())
+	defer timer.Stop()
+
+	var lastErr error
+	for done := 0; done < launched; {
+		select {
+		case <-timer.C:
+			if launched < maxAttempts {
+				launch()
+				timer.Reset(g.hedgeDelay())
+			}
+
+		case r := <-results:
+			done++
+			if r.err == nil {
+				if r.hedged {
+					metrics.GeocoderHedges.WithLabelValues("won").Inc()
+				}
+				return r.res, nil
+			}
+			lastErr = r.err
+			// реплика упала раньше дедлайна — не ждём таймер;
+			// но на исчерпанную квоту новый дубль не шлём — он тоже в неё упрётся
+			if launched < maxAttempts && !errors.Is(r.err, ErrRateLimited) {
+				launch()
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// hedgeDelay — перцентиль недавних латентностей, но не меньше MinDelay
+func (g *Geocoder) hedgeDelay() time.Duration {
+	d, ok := g.latencies.percentile(g.hedge.Percentile, minHedgeSamples)
+	if !ok || d < g.hedge.MinDelay {
+		return g.hedge.MinDelay
+	}
+	return d
+}
+
+// latencyWindow — кольцевой буфер последних латентностей ответов
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	pos     int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	w.samples[w.pos] = d
+	w.pos++
+	if w.pos == len(w.samples) {
+		w.pos = 0
+		w.full = true
+	}
+	w.mu.Unlock()
+}
+
+// percentile — p-й перцентиль окна; false, если выборка меньше minSamples
+func (w *latencyWindow) percentile(p float64, minSamples int) (time.Duration, bool) {
+	w.mu.Lock()
+	n := w.pos
+	if w.full {
+		n = len(w.samples)
+	}
+	if n < minSamples {
+		w.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(n-1))], true
+}
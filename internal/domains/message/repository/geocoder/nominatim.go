@@ -0,0 +1,173 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/domains/message/trigger"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Nominatim — адаптер для Nominatim-совместимого GET /reverse.
+// Такой API не умеет батчи, поэтому позиции запрашиваются параллельно по одной.
+// Ошибка одной позиции остаётся в её Result.Err; батч падает, только если упали все.
+type Nominatim struct {
+	baseURL  string
+	client   *http.Client
+	parallel int
+}
+
+type nominatimResponse struct {
+	PlaceID     flexString `json:"place_id"`
+	Lat         string     `json:"lat"`
+	Lon         string     `json:"lon"`
+	DisplayName string     `json:"display_name"`
+	Importance  float64    `json:"importance"`
+	Address     struct {
+		Country     string `json:"country"`
+		State       string `json:"state"`
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		Road        string `json:"road"`
+		HouseNumber string `json:"house_number"`
+		Postcode    string `json:"postcode"`
+	} `json:"address"`
+	Error string `json:"error"`
+}
+
+func NewNominatim(baseURL string, timeoutMs int, maxConns int) *Nominatim {
+	if maxConns <= 0 {
+		maxConns = 10
+	}
+	return &Nominatim{
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout: time.Duration(timeoutMs) * time.Millisecond,
+			Transport: &http.Transport{
+				MaxIdleConns:        maxConns,
+				MaxIdleConnsPerHost: maxConns,
+				MaxConnsPerHost:     maxConns,
+				IdleConnTimeout:     90 * time.Second,
+				ForceAttemptHTTP2:   true,
+			},
+		},
+		parallel: maxConns,
+	}
+}
+
+func (n *Nominatim) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	results := make([]Result, len(positions))
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, n.parallel)
+	)
+
+	for i, pos := range positions {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(i int, pos model.Pos) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			r, err := n.reverse(ctx, pos, lang)
+			if err != nil {
+				r = Result{Provider: ProviderNominatim, Err: err}
+			}
+			results[i] = r
+		}(i, pos)
+	}
+
+	wg.Wait()
+
+	var failed int
+	var firstErr error
+	for i, r := range results {
+		if r.Err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("position %d: %w", i, r.Err)
+			}
+			failed++
+		}
+	}
+	if len(results) > 0 && failed == len(results) {
+		return nil, firstErr
+	}
+
+	return results, nil
+}
+
+func (n *Nominatim) reverse(ctx context.Context, pos model.Pos, lang string) (Result, error) {
+	q := url.Values{}
+	q.Set("format", "jsonv2")
+	q.Set("lat", strconv.FormatFloat(pos.Y, 'f', -1, 64))
+	q.Set("lon", strconv.FormatFloat(pos.X, 'f', -1, 64))
+	if lang != "" {
+		q.Set("accept-language", lang)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+"/reverse?"+q.Encode(), nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("create req: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("do req: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("nominatim status %d", resp.StatusCode)
+	}
+
+	var r nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return Result{}, fmt.Errorf("decode resp: %w", err)
+	}
+
+	// "Unable to geocode" — точка вне покрытия, это не ошибка батча
+	if r.Error != "" {
+		return Result{Provider: ProviderNominatim}, nil
+	}
+
+	city := r.Address.City
+	if city == "" {
+		city = r.Address.Town
+	}
+	if city == "" {
+		city = r.Address.Village
+	}
+
+	details := &model.AddressDetails{
+		Components: model.AddressComponents{
+			Country:     r.Address.Country,
+			Region:      r.Address.State,
+			City:        city,
+			Street:      r.Address.Road,
+			HouseNumber: r.Address.HouseNumber,
+			Postcode:    r.Address.Postcode,
+		},
+		PlaceID:    string(r.PlaceID),
+		Confidence: r.Importance,
+	}
+	if lat, err := strconv.ParseFloat(r.Lat, 64); err == nil {
+		if lon, err := strconv.ParseFloat(r.Lon, 64); err == nil {
+			details.DistanceM = trigger.DistanceMeters(pos.Y, pos.X, lat, lon)
+		}
+	}
+
+	return Result{Address: r.DisplayName, Details: details, Provider: ProviderNominatim}, nil
+}
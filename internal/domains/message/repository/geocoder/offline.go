@@ -0,0 +1,512 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/domains/message/trigger"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Offline — обратный геокодер по локальному датасету без сети: административные
+// границы и улицы из GeoJSON или именованные точки из CSV, в R-деревьях в памяти.
+// Годится для закрытых контуров и как последний рубеж за HTTP-геокодером.
+// Переводы названий берутся из свойств name:<lang> (name:kk, name:en...).
+type Offline struct {
+	boundaries   []boundary
+	boundaryTree *rtree
+	streets      []street
+	streetTree   *rtree
+	points       []namedPoint
+	pointTree    *rtree
+
+	maxDistanceM float64 // дальше этого улицу/точку не считаем найденной
+}
+
+type point struct {
+	x, y float64 // долгота, широта
+}
+
+// boundary — полигон(ы) административной единицы; кольцо 0 — внешнее, остальные — дырки
+type boundary struct {
+	name     names
+	level    int // admin_level OSM: 2 — страна, 4 — регион, 6..8 — город/район
+	polygons [][][]point
+}
+
+type street struct {
+	name  names
+	lines [][]point
+}
+
+type namedPoint struct {
+	p          point
+	name       names
+	components model.AddressComponents
+}
+
+// LoadOffline читает датасет: .geojson/.json — FeatureCollection, .csv — точки
+func LoadOffline(path string, maxDistanceM float64) (*Offline, error) {
+	if maxDistanceM <= 0 {
+		maxDistanceM = 200
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open dataset: %w", err)
+	}
+	defer f.Close()
+
+	o := &Offline{maxDistanceM: maxDistanceM}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = o.loadCSV(bufio.NewReader(f))
+	case ".geojson", ".json":
+		err = o.loadGeoJSON(bufio.NewReader(f))
+	default:
+		err = fmt.Errorf("unsupported dataset format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+
+	o.buildIndexes()
+	println("📍 offline geocoder:", len(o.boundaries), "boundaries,", len(o.streets), "streets,", len(o.points), "points")
+
+	return o, nil
+}
+
+// names — название объекта и его переводы
+type names struct {
+	def    string
+	byLang map[string]string // nil, если переводов нет
+}
+
+func (n names) in(lang string) string {
+	if s, ok := n.byLang[lang]; ok {
+		return s
+	}
+	return n.def
+}
+
+func (o *Offline) GetAddresses(ctx context.Context, positions []model.Pos, lang string) ([]Result, error) {
+	results := make([]Result, len(positions))
+	for i, p := range positions {
+		if i%256 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		results[i] = o.reverse(p, lang)
+	}
+	return results, nil
+}
+
+func (o *Offline) reverse(pos model.Pos, lang string) Result {
+	x, y := pos.X, pos.Y
+	proj := newProjection(y)
+
+	var c model.AddressComponents
+
+	// границы, в которые попала точка — от страны к городу
+	var hits []*boundary
+	o.boundaryTree.search(x, y, func(i int) {
+		if o.boundaries[i].contains(x, y) {
+			hits = append(hits, &o.boundaries[i])
+		}
+	})
+	sort.Slice(hits, func(i, j int) bool { return hits[i].level < hits[j].level })
+	for _, b := range hits {
+		switch {
+		case b.level <= 2:
+			c.Country = b.name.in(lang)
+		case b.level <= 5:
+			if c.Region == "" {
+				c.Region = b.name.in(lang)
+			}
+		default:
+			c.City = b.name.in(lang) // самый детальный уровень перезапишет предыдущий
+		}
+	}
+
+	boxDist := func(r rect) float64 {
+		return proj.dist(x, y, clamp(x, r.minX, r.maxX), clamp(y, r.minY, r.maxY))
+	}
+
+	dist := -1.0
+	var placeName string
+
+	if si, d, ok := o.streetTree.nearest(o.maxDistanceM, boxDist, func(i int) float64 {
+		return o.streets[i].distance(proj, x, y)
+	}); ok {
+		c.Street = o.streets[si].name.in(lang)
+		dist = d
+	}
+
+	if pi, d, ok := o.pointTree.nearest(o.maxDistanceM, boxDist, func(i int) float64 {
+		p := o.points[i].p
+		return proj.dist(x, y, p.x, p.y)
+	}); ok && (dist < 0 || d < dist) {
+		np := o.points[pi]
+		placeName = np.name.in(lang)
+		c = mergeComponents(c, np.components)
+		dist = d
+	}
+
+	if c == (model.AddressComponents{}) && placeName == "" {
+		return Result{Provider: ProviderOffline}
+	}
+
+	details := &model.AddressDetails{Components: c, Confidence: 0.5}
+	if dist >= 0 {
+		details.DistanceM = dist
+		details.Confidence = 1 - dist/o.maxDistanceM
+	}
+
+	parts := make([]string, 0, 5)
+	for _, s := range []string{c.Country, c.Region, c.City, c.Street, c.HouseNumber} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if placeName != "" && placeName != c.Street {
+		parts = append(parts, placeName)
+	}
+
+	return Result{
+		Address:  strings.Join(parts, ", "),
+		Details:  details,
+		Provider: ProviderOffline,
+	}
+}
+
+// mergeComponents — поля точки из CSV важнее найденных по границам
+func mergeComponents(base, over model.AddressComponents) model.AddressComponents {
+	if over.Country != "" {
+		base.Country = over.Country
+	}
+	if over.Region != "" {
+		base.Region = over.Region
+	}
+	if over.City != "" {
+		base.City = over.City
+	}
+	if over.Street != "" {
+		base.Street = over.Street
+	}
+	if over.HouseNumber != "" {
+		base.HouseNumber = over.HouseNumber
+	}
+	if over.Postcode != "" {
+		base.Postcode = over.Postcode
+	}
+	return base
+}
+
+func (o *Offline) buildIndexes() {
+	boxes := make([]rect, len(o.boundaries))
+	for i, b := range o.boundaries {
+		boxes[i] = bboxOf(b.polygons...)
+	}
+	o.boundaryTree = newRTree(boxes)
+
+	boxes = make([]rect, len(o.streets))
+	for i, s := range o.streets {
+		boxes[i] = bboxOf(s.lines)
+	}
+	o.streetTree = newRTree(boxes)
+
+	boxes = make([]rect, len(o.points))
+	for i, p := range o.points {
+		boxes[i] = rect{minX: p.p.x, minY: p.p.y, maxX: p.p.x, maxY: p.p.y}
+	}
+	o.pointTree = newRTree(boxes)
+}
+
+// ----------- ГЕОМЕТРИЯ -----------
+
+// projection — равнопромежуточная проекция вокруг широты запроса: на сотнях метров
+// ошибка ничтожна, зато расстояние до отрезка считается в плоскости
+type projection struct {
+	kx, ky float64 // метров в градусе долготы/широты
+}
+
+func newProjection(lat float64) projection {
+	ky := trigger.EarthRadiusMeters * math.Pi / 180
+	return projection{kx: ky * math.Cos(lat*math.Pi/180), ky: ky}
+}
+
+func (p projection) dist(x1, y1, x2, y2 float64) float64 {
+	return math.Hypot((x2-x1)*p.kx, (y2-y1)*p.ky)
+}
+
+// segmentDist — расстояние от (x, y) до отрезка a-b в метрах
+func (p projection) segmentDist(x, y float64, a, b point) float64 {
+	ax, ay := (a.x-x)*p.kx, (a.y-y)*p.ky
+	bx, by := (b.x-x)*p.kx, (b.y-y)*p.ky
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = clamp(-(ax*dx+ay*dy)/l2, 0, 1)
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+func (s *street) distance(p projection, x, y float64) float64 {
+	best := math.Inf(1)
+	for _, line := range s.lines {
+		if len(line) == 1 {
+			best = math.Min(best, p.dist(x, y, line[0].x, line[0].y))
+			continue
+		}
+		for i := 1; i < len(line); i++ {
+			best = math.Min(best, p.segmentDist(x, y, line[i-1], line[i]))
+		}
+	}
+	return best
+}
+
+func (b *boundary) contains(x, y float64) bool {
+	for _, poly := range b.polygons {
+		if len(poly) == 0 || !ringContains(poly[0], x, y) {
+			continue
+		}
+		inHole := false
+		for _, hole := range poly[1:] {
+			if ringContains(hole, x, y) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains — ray casting
+func ringContains(ring []point, x, y float64) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.y > y) != (b.y > y) && x < (b.x-a.x)*(y-a.y)/(b.y-a.y)+a.x {
+			in = !in
+		}
+	}
+	return in
+}
+
+func bboxOf(groups ...[][]point) rect {
+	r := rect{minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+	for _, g := range groups {
+		for _, line := range g {
+			for _, p := range line {
+				r = r.extend(rect{minX: p.x, minY: p.y, maxX: p.x, maxY: p.y})
+			}
+		}
+	}
+	return r
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// ----------- ЗАГРУЗКА -----------
+
+type geoJSONCollection struct {
+	Features []struct {
+		Geometry struct {
+			Type        string              `json:"type"`
+			Coordinates jsoniter.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+}
+
+func (o *Offline) loadGeoJSON(r io.Reader) error {
+	var fc geoJSONCollection
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return fmt.Errorf("decode geojson: %w", err)
+	}
+
+	for i, f := range fc.Features {
+		name := featureNames(f.Properties)
+		if name.def == "" {
+			continue
+		}
+
+		var err error
+		switch f.Geometry.Type {
+		case "Point":
+			var c [2]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &c); err == nil {
+				o.points = append(o.points, namedPoint{p: point{c[0], c[1]}, name: name})
+			}
+		case "LineString":
+			var c [][2]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &c); err == nil {
+				o.streets = append(o.streets, street{name: name, lines: [][]point{toPoints(c)}})
+			}
+		case "MultiLineString":
+			var c [][][2]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &c); err == nil {
+				o.streets = append(o.streets, street{name: name, lines: toRings(c)})
+			}
+		case "Polygon":
+			var c [][][2]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &c); err == nil {
+				o.boundaries = append(o.boundaries, boundary{name: name, level: adminLevel(f.Properties), polygons: [][][]point{toRings(c)}})
+			}
+		case "MultiPolygon":
+			var c [][][][2]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &c); err == nil {
+				polys := make([][][]point, len(c))
+				for j, p := range c {
+					polys[j] = toRings(p)
+				}
+				o.boundaries = append(o.boundaries, boundary{name: name, level: adminLevel(f.Properties), polygons: polys})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("feature %d (%s): %w", i, f.Geometry.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// loadCSV — заголовок обязателен: lat, lon, name и по желанию
+// name:<lang>, country, region, city, street, house_number, postcode
+func (o *Offline) loadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, req := range []string{"lat", "lon"} {
+		if _, ok := col[req]; !ok {
+			return fmt.Errorf("csv: column %q is required", req)
+		}
+	}
+
+	get := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("csv line %d: %w", line, err)
+		}
+
+		lat, err := strconv.ParseFloat(get(rec, "lat"), 64)
+		if err != nil {
+			return fmt.Errorf("csv line %d: bad lat: %w", line, err)
+		}
+		lon, err := strconv.ParseFloat(get(rec, "lon"), 64)
+		if err != nil {
+			return fmt.Errorf("csv line %d: bad lon: %w", line, err)
+		}
+
+		o.points = append(o.points, namedPoint{
+			p:    point{lon, lat},
+			name: csvNames(header, rec, get(rec, "name")),
+			components: model.AddressComponents{
+				Country:     get(rec, "country"),
+				Region:      get(rec, "region"),
+				City:        get(rec, "city"),
+				Street:      get(rec, "street"),
+				HouseNumber: get(rec, "house_number"),
+				Postcode:    get(rec, "postcode"),
+			},
+		})
+	}
+}
+
+func toPoints(c [][2]float64) []point {
+	out := make([]point, len(c))
+	for i, xy := range c {
+		out[i] = point{xy[0], xy[1]}
+	}
+	return out
+}
+
+func toRings(c [][][2]float64) [][]point {
+	out := make([][]point, len(c))
+	for i, ring := range c {
+		out[i] = toPoints(ring)
+	}
+	return out
+}
+
+// featureNames собирает name и все name:<lang> из свойств GeoJSON
+func featureNames(props map[string]interface{}) names {
+	n := names{}
+	for k, v := range props {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			continue
+		}
+		if k == "name" {
+			n.def = s
+		} else if lang, ok := strings.CutPrefix(k, "name:"); ok {
+			if n.byLang == nil {
+				n.byLang = make(map[string]string)
+			}
+			n.byLang[strings.ToLower(lang)] = s
+		}
+	}
+	return n
+}
+
+func csvNames(header, rec []string, def string) names {
+	n := names{def: def}
+	for i, h := range header {
+		lang, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(h)), "name:")
+		if !ok || i >= len(rec) || strings.TrimSpace(rec[i]) == "" {
+			continue
+		}
+		if n.byLang == nil {
+			n.byLang = make(map[string]string)
+		}
+		n.byLang[lang] = strings.TrimSpace(rec[i])
+	}
+	return n
+}
+
+// adminLevel — admin_level бывает и числом, и строкой; без него считаем городом
+func adminLevel(props map[string]interface{}) int {
+	switch v := props["admin_level"].(type) {
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return 8
+}
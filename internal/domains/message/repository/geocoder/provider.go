@@ -0,0 +1,49 @@
+package geocoder
+
+import "fmt"
+
+const (
+	ProviderGeocache    = "geocache"
+	ProviderNominatim   = "nominatim"
+	ProviderCoordinates = "coordinates"
+	ProviderOffline     = "offline"
+)
+
+// ProviderConfig — параметры одного бэкенда; что из них нужно, зависит от провайдера
+type ProviderConfig struct {
+	Provider  string
+	BaseURLs  []string // geocache: реплики; остальным нужен только первый
+	TimeoutMs int
+	MaxConns  int
+	MaxBatch  int // geocache: позиций в одном POST; не меньше верхней границы регулятора
+	Hedge     HedgePolicy
+	RateLimit *RateLimiter // geocache: квота на POST; nil — без неё
+
+	DatasetPath  string  // offline: GeoJSON или CSV
+	MaxDistanceM float64 // offline: радиус поиска улицы/точки
+}
+
+// NewReverseGeocoder собирает бэкенд по имени провайдера из конфига
+func NewReverseGeocoder(pc ProviderConfig) (ReverseGeocoder, error) {
+	switch pc.Provider {
+	case "", ProviderGeocache:
+		if len(pc.BaseURLs) == 0 {
+			return nil, fmt.Errorf("geocoder provider %q requires base_urls", ProviderGeocache)
+		}
+		return New(pc.BaseURLs, pc.TimeoutMs, pc.MaxConns, pc.MaxBatch, pc.Hedge, pc.RateLimit), nil
+	case ProviderNominatim:
+		if len(pc.BaseURLs) == 0 {
+			return nil, fmt.Errorf("geocoder provider %q requires base_url", pc.Provider)
+		}
+		return NewNominatim(pc.BaseURLs[0], pc.TimeoutMs, pc.MaxConns), nil
+	case ProviderCoordinates:
+		return NewCoordinates(), nil
+	case ProviderOffline:
+		if pc.DatasetPath == "" {
+			return nil, fmt.Errorf("geocoder provider %q requires dataset_path", pc.Provider)
+		}
+		return LoadOffline(pc.DatasetPath, pc.MaxDistanceM)
+	default:
+		return nil, fmt.Errorf("unknown geocoder provider %q", pc.Provider)
+	}
+}
@@ -0,0 +1,92 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited — квота геокодера исчерпана дольше, чем мы готовы ждать.
+// Это не поломка бэкенда: breaker её не считает, цепочка не переключается на запасной.
+var ErrRateLimited = errors.New("geocoder rate limit exceeded")
+
+// RateLimit — квота от владельцев geocache; 0 в *PerSec — без ограничения по этой оси
+type RateLimit struct {
+	PositionsPerSec float64
+	PositionsBurst  int // не меньше позиций в одном POST; 0 — perSec
+	BatchesPerSec   float64
+	BatchesBurst    int
+	MaxWait         time.Duration // дольше ждать токены не будем — ErrRateLimited
+}
+
+// RateLimiter — квота с двумя token bucket: позиции в секунду и POST в секунду.
+// Его спрашивает сам клиент перед каждым POST, так что дробление батча
+// и дубли хеджирования расходуют токены как обычные запросы.
+// POST ждёт токены не дольше MaxWait, иначе сразу отдаёт ErrRateLimited,
+// и usecase публикует сообщения с прошлым адресом вместо бесконечной очереди.
+type RateLimiter struct {
+	positions *rate.Limiter
+	batches   *rate.Limiter
+	maxWait   time.Duration
+}
+
+func NewRateLimiter(cfg RateLimit) *RateLimiter {
+	return &RateLimiter{
+		positions: newBucket(cfg.PositionsPerSec, cfg.PositionsBurst),
+		batches:   newBucket(cfg.BatchesPerSec, cfg.BatchesBurst),
+		maxWait:   cfg.MaxWait,
+	}
+}
+
+func newBucket(perSec float64, burst int) *rate.Limiter {
+	if perSec <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst <= 0 {
+		burst = int(perSec)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return rate.NewLimiter(rate.Limit(perSec), burst)
+}
+
+// Wait резервирует токены на один POST из n позиций сразу в обоих ведрах
+// и ждёт дольшую из задержек. Если ждать дольше maxWait — резервы
+// возвращаются и запрос отклоняется. nil — без ограничения.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+
+	pr := l.positions.ReserveN(now, n)
+	if !pr.OK() {
+		return fmt.Errorf("%w: request of %d positions exceeds burst %d", ErrRateLimited, n, l.positions.Burst())
+	}
+	br := l.batches.ReserveN(now, 1)
+
+	delay := max(pr.DelayFrom(now), br.DelayFrom(now))
+	if delay == 0 {
+		return nil
+	}
+	if delay > l.maxWait {
+		pr.CancelAt(now)
+		br.CancelAt(now)
+		return ErrRateLimited
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		pr.Cancel()
+		br.Cancel()
+		return ctx.Err()
+	}
+}
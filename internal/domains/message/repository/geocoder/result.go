@@ -0,0 +1,159 @@
+package geocoder
+
+import (
+	"AddressService/internal/domains/message/model"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	// ErrLengthMismatch — ответов не столько, сколько позиций, или индексы не сходятся.
+	// Сопоставить адреса с позициями нельзя, весь батч считается упавшим.
+	ErrLengthMismatch = errors.New("geocoder response does not match request")
+
+	// ErrMissingItem — в ответе с индексами не нашлось элемента для позиции
+	ErrMissingItem = errors.New("geocoder returned no result for position")
+)
+
+// Result — адрес для одной позиции. Details заполнен, только если провайдер
+// вернул структурированный объект, а не голую строку.
+// Err != nil — эту позицию геокодер не осилил, остальные позиции батча валидны.
+type Result struct {
+	Address  string
+	Details  *model.AddressDetails
+	Provider string // какой бэкенд ответил (geocache, nominatim, coordinates...)
+	Err      error
+}
+
+// geocacheItem — объектная форма элемента ответа /reverse_batch
+type geocacheItem struct {
+	Index      *int   `json:"index"` // номер позиции в запросе; без него — по порядку
+	Error      string `json:"error"` // ошибка по этой позиции
+	Address    string `json:"address"`
+	Components struct {
+		Country     string `json:"country"`
+		Region      string `json:"region"`
+		City        string `json:"city"`
+		Street      string `json:"street"`
+		HouseNumber string `json:"house_number"`
+		Postcode    string `json:"postcode"`
+	} `json:"components"`
+	PlaceID    flexString `json:"place_id"`
+	Distance   float64    `json:"distance"`
+	Confidence float64    `json:"confidence"`
+}
+
+// flexString принимает и строку, и число (place_id у разных серверов разный)
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		*f = ""
+		return nil
+	}
+	if data[0] == '"' {
+		s, err := strconv.Unquote(string(data))
+		if err != nil {
+			return err
+		}
+		*f = flexString(s)
+		return nil
+	}
+	*f = flexString(data)
+	return nil
+}
+
+// decodeGeocacheItem разбирает элемент ответа: строка (старый формат), объект или null.
+// index == -1 — элемент без явного индекса, его позиция определяется порядком.
+func decodeGeocacheItem(raw []byte) (index int, r Result, err error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return -1, Result{}, nil
+	}
+
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return -1, Result{}, err
+		}
+		return -1, Result{Address: s}, nil
+	}
+
+	var item geocacheItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return -1, Result{}, fmt.Errorf("decode item: %w", err)
+	}
+
+	index = -1
+	if item.Index != nil {
+		index = *item.Index
+	}
+	if item.Error != "" {
+		return index, Result{Err: errors.New(item.Error)}, nil
+	}
+
+	return index, Result{
+		Address: item.Address,
+		Details: &model.AddressDetails{
+			Components: model.AddressComponents{
+				Country:     item.Components.Country,
+				Region:      item.Components.Region,
+				City:        item.Components.City,
+				Street:      item.Components.Street,
+				HouseNumber: item.Components.HouseNumber,
+				Postcode:    item.Components.Postcode,
+			},
+			PlaceID:    string(item.PlaceID),
+			DistanceM:  item.Distance,
+			Confidence: item.Confidence,
+		},
+	}, nil
+}
+
+// placeGeocacheItems раскладывает элементы ответа по позициям запроса.
+// Либо у всех элементов есть index, либо их ровно n и они идут по порядку —
+// иначе ErrLengthMismatch: подставить адрес не той точке хуже, чем повторить батч.
+func placeGeocacheItems(n int, items []jsoniter.RawMessage) ([]Result, error) {
+	results := make([]Result, n)
+	filled := make([]bool, n)
+	indexed := 0
+
+	for i, raw := range items {
+		idx, r, err := decodeGeocacheItem(raw)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		if idx < 0 {
+			idx = i
+		} else {
+			indexed++
+		}
+		if idx >= n || filled[idx] {
+			return nil, fmt.Errorf("%w: item %d points to position %d of %d", ErrLengthMismatch, i, idx, n)
+		}
+		r.Provider = ProviderGeocache
+		results[idx] = r
+		filled[idx] = true
+	}
+
+	switch {
+	case indexed == 0 && len(items) != n:
+		return nil, fmt.Errorf("%w: sent %d positions, got %d items", ErrLengthMismatch, n, len(items))
+	case indexed != 0 && indexed != len(items):
+		return nil, fmt.Errorf("%w: only %d of %d items have an index", ErrLengthMismatch, indexed, len(items))
+	}
+
+	// ответ с индексами может пропустить позицию — это ошибка только этой позиции
+	for i := range results {
+		if !filled[i] {
+			results[i] = Result{Provider: ProviderGeocache, Err: ErrMissingItem}
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,170 @@
+package geocoder
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// rect — ограничивающий прямоугольник в градусах (X — долгота, Y — широта)
+type rect struct {
+	minX, minY, maxX, maxY float64
+}
+
+func (r rect) contains(x, y float64) bool {
+	return x >= r.minX && x <= r.maxX && y >= r.minY && y <= r.maxY
+}
+
+func (r rect) extend(o rect) rect {
+	return rect{
+		minX: math.Min(r.minX, o.minX),
+		minY: math.Min(r.minY, o.minY),
+		maxX: math.Max(r.maxX, o.maxX),
+		maxY: math.Max(r.maxY, o.maxY),
+	}
+}
+
+// rtreeNode — лист хранит индекс объекта, внутренний узел — детей
+type rtreeNode struct {
+	box      rect
+	children []*rtreeNode
+	item     int
+}
+
+// rtree — статическое R-дерево, собранное один раз методом STR (Sort-Tile-Recursive).
+// Датасет после загрузки не меняется, поэтому вставки/удаления не нужны.
+type rtree struct {
+	root *rtreeNode
+}
+
+const rtreeNodeSize = 16
+
+func newRTree(boxes []rect) *rtree {
+	if len(boxes) == 0 {
+		return &rtree{}
+	}
+
+	level := make([]*rtreeNode, len(boxes))
+	for i, b := range boxes {
+		level[i] = &rtreeNode{box: b, item: i}
+	}
+
+	for len(level) > 1 {
+		level = packLevel(level)
+	}
+
+	return &rtree{root: level[0]}
+}
+
+// packLevel группирует узлы уровня в родителей по rtreeNodeSize
+func packLevel(nodes []*rtreeNode) []*rtreeNode {
+	leafCount := (len(nodes) + rtreeNodeSize - 1) / rtreeNodeSize
+	slices := int(math.Ceil(math.Sqrt(float64(leafCount))))
+	sliceSize := slices * rtreeNodeSize
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].box.minX+nodes[i].box.maxX < nodes[j].box.minX+nodes[j].box.maxX
+	})
+
+	parents := make([]*rtreeNode, 0, leafCount)
+	for start := 0; start < len(nodes); start += sliceSize {
+		end := start + sliceSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		slice := nodes[start:end]
+		sort.Slice(slice, func(i, j int) bool {
+			return slice[i].box.minY+slice[i].box.maxY < slice[j].box.minY+slice[j].box.maxY
+		})
+
+		for s := 0; s < len(slice); s += rtreeNodeSize {
+			e := s + rtreeNodeSize
+			if e > len(slice) {
+				e = len(slice)
+			}
+			children := make([]*rtreeNode, e-s)
+			copy(children, slice[s:e])
+
+			box := children[0].box
+			for _, c := range children[1:] {
+				box = box.extend(c.box)
+			}
+			parents = append(parents, &rtreeNode{box: box, children: children, item: -1})
+		}
+	}
+
+	return parents
+}
+
+// search вызывает fn для каждого объекта, чей прямоугольник содержит точку
+func (t *rtree) search(x, y float64, fn func(item int)) {
+	if t.root == nil {
+		return
+	}
+
+	stack := []*rtreeNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !n.box.contains(x, y) {
+			continue
+		}
+		if n.children == nil {
+			fn(n.item)
+			continue
+		}
+		stack = append(stack, n.children...)
+	}
+}
+
+// nearest ищет ближайший объект не дальше maxDist (best-first).
+// boxDist — нижняя оценка расстояния до прямоугольника, itemDist — точное до объекта;
+// обе в одних единицах.
+func (t *rtree) nearest(maxDist float64, boxDist func(rect) float64, itemDist func(item int) float64) (int, float64, bool) {
+	if t.root == nil {
+		return 0, 0, false
+	}
+
+	q := &nodeQueue{{node: t.root, dist: boxDist(t.root.box)}}
+	for q.Len() > 0 {
+		c := heap.Pop(q).(queued)
+		if c.dist > maxDist {
+			return 0, 0, false
+		}
+
+		// точное расстояние до объекта — всё, что осталось в очереди, не ближе
+		if c.exact {
+			return c.node.item, c.dist, true
+		}
+
+		if c.node.children == nil {
+			heap.Push(q, queued{node: c.node, dist: itemDist(c.node.item), exact: true})
+			continue
+		}
+		for _, child := range c.node.children {
+			heap.Push(q, queued{node: child, dist: boxDist(child.box)})
+		}
+	}
+
+	return 0, 0, false
+}
+
+type queued struct {
+	node  *rtreeNode
+	dist  float64
+	exact bool
+}
+
+type nodeQueue []queued
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queued)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, с которыми исходное сообщение уходит в DLQ
+const (
+	HeaderDLQSourceTopic     = "x-dlq-source-topic"
+	HeaderDLQSourcePartition = "x-dlq-source-partition"
+	HeaderDLQSourceOffset    = "x-dlq-source-offset"
+	HeaderDLQError           = "x-dlq-error"
+)
+
+// DeadLetterProducer складывает нераспознанные сырые сообщения в отдельный топик,
+// чтобы их можно было разобрать и переотправить руками.
+type DeadLetterProducer interface {
+	Send(ctx context.Context, src kafka.Message, cause error) error
+	Close() error
+}
+
+type deadLetterProducer struct {
+	writer *kafka.Writer
+}
+
+func NewDeadLetterProducer(brokers []string, topic string) DeadLetterProducer {
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.LeastBytes{},
+		Async:                  false, // синхронно: оффсет коммитим только после записи в DLQ
+		BatchTimeout:           5 * time.Millisecond,
+		RequiredAcks:           kafka.RequireOne,
+		AllowAutoTopicCreation: true,
+	}
+
+	return &deadLetterProducer{writer: writer}
+}
+
+// Send пишет оригинальные байты как есть, причину и координаты источника — в заголовки
+func (p *deadLetterProducer) Send(ctx context.Context, src kafka.Message, cause error) error {
+	headers := make([]kafka.Header, 0, len(src.Headers)+4)
+	headers = append(headers, src.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQSourceTopic, Value: []byte(src.Topic)},
+		kafka.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(src.Partition))},
+		kafka.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(src.Offset, 10))},
+	)
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())})
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     src.Key,
+		Value:   src.Value,
+		Headers: headers,
+	})
+}
+
+func (p *deadLetterProducer) Close() error {
+	return p.writer.Close()
+}
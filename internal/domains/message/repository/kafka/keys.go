@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"AddressService/internal/domains/message/model"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KeyStrategy — чем ключевать обогащённые сообщения
+type KeyStrategy string
+
+const (
+	// KeyDeviceID — ключ = ID устройства: все его сообщения попадают в одну партицию
+	// и читаются потребителями в порядке публикации
+	KeyDeviceID KeyStrategy = "device_id"
+	// KeyNone — без ключа, балансировщик раскидывает сообщения по всем партициям
+	KeyNone KeyStrategy = "none"
+)
+
+// ParseKeyStrategy разбирает kafka.key_strategy; пусто — KeyDeviceID
+func ParseKeyStrategy(s string) (KeyStrategy, error) {
+	switch KeyStrategy(s) {
+	case "", KeyDeviceID:
+		return KeyDeviceID, nil
+	case KeyNone:
+		return KeyNone, nil
+	default:
+		return "", fmt.Errorf("unknown kafka key strategy %q (want device_id | none)", s)
+	}
+}
+
+func (k KeyStrategy) key(m *model.Message) []byte {
+	if k == KeyNone {
+		return nil
+	}
+	return strconv.AppendInt(nil, m.ID, 10)
+}
+
+// Заголовки обогащённого сообщения
+const (
+	HeaderSourceTopic     = "x-source-topic"
+	HeaderSourcePartition = "x-source-partition"
+	HeaderSourceOffset    = "x-source-offset"
+	HeaderEnrichment      = "x-enrichment"
+	HeaderProvider        = "x-geocoder-provider"
+)
+
+// headers — откуда пришло сообщение и откуда у него адрес; пустые не пишем
+func headers(m *model.Message) []kafka.Header {
+	h := make([]kafka.Header, 0, 5)
+	if m.Source != nil {
+		h = append(h,
+			kafka.Header{Key: HeaderSourceTopic, Value: []byte(m.Source.Topic)},
+			kafka.Header{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(m.Source.Partition))},
+			kafka.Header{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(m.Source.Offset, 10))},
+		)
+	}
+	if m.Enrichment != "" {
+		h = append(h, kafka.Header{Key: HeaderEnrichment, Value: []byte(m.Enrichment)})
+	}
+	if m.Provider != "" {
+		h = append(h, kafka.Header{Key: HeaderProvider, Value: []byte(m.Provider)})
+	}
+	return h
+}
@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"AddressService/internal/domains/message/model"
+	"AddressService/internal/metrics"
 	"context"
 	"time"
 
@@ -12,7 +13,6 @@ import (
 var json = jsoniter.ConfigFastest
 
 type KafkaProducer interface {
-	Produce(ctx context.Context, msg *model.Message) error
 	ProduceBatch(ctx context.Context, msgs []*model.Message) error
 	Close() error
 }
@@ -20,9 +20,12 @@ type KafkaProducer interface {
 type kafkaProducer struct {
 	writer *kafka.Writer
 	topic  string
+	keys   KeyStrategy
 }
 
-func NewKafkaProducer(brokers []string, topic string) KafkaProducer {
+// NewKafkaProducer — keys задаёт ключ сообщения: с KeyDeviceID CRC32Balancer
+// кладёт все сообщения устройства в одну партицию
+func NewKafkaProducer(brokers []string, topic string, keys KeyStrategy) KafkaProducer {
 	writer := &kafka.Writer{
 		Addr:                   kafka.TCP(brokers...),
 		Topic:                  topic,
@@ -36,6 +39,10 @@ func NewKafkaProducer(brokers []string, topic string) KafkaProducer {
 		Completion: func(messages []kafka.Message, err error) {
 			if err != nil {
 				println("❌ Kafka write error:", err.Error())
+				metrics.ProducerCompletionErrors.Add(float64(len(messages)))
+			}
+			for _, m := range messages {
+				ack(m, err)
 			}
 		},
 	}
@@ -43,22 +50,10 @@ func NewKafkaProducer(brokers []string, topic string) KafkaProducer {
 	return &kafkaProducer{
 		writer: writer,
 		topic:  topic,
+		keys:   keys,
 	}
 }
 
-// отправка одного сообщения
-func (p *kafkaProducer) Produce(_ context.Context, msg *model.Message) error {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		println("❌ KafkaProducer: Marshal error:", err.Error())
-		return err
-	}
-
-	return p.writer.WriteMessages(context.Background(), kafka.Message{
-		Value: data,
-	})
-}
-
 // батч-отправка (вызов горутиной — отлично)
 func (p *kafkaProducer) ProduceBatch(_ context.Context, msgs []*model.Message) error {
 	if len(msgs) == 0 {
@@ -70,13 +65,52 @@ func (p *kafkaProducer) ProduceBatch(_ context.Context, msgs []*model.Message) e
 		data, err := json.Marshal(m)
 		if err != nil {
 			println("⚠️ KafkaProducer: skip bad message:", err.Error())
+			if m.Ack != nil {
+				m.Ack(nil)
+			}
 			continue
 		}
-		kmsgs = append(kmsgs, kafka.Message{Value: data})
+		kmsgs = append(kmsgs, p.message(m, data))
 	}
 
 	// Writer сам разобьёт на внутренние пакеты по BatchSize/BatchTimeout
-	return p.writer.WriteMessages(context.Background(), kmsgs...)
+	if err := p.writer.WriteMessages(context.Background(), kmsgs...); err != nil {
+		metrics.ProducerCompletionErrors.Add(float64(len(kmsgs)))
+		for _, km := range kmsgs {
+			ack(km, err)
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, m := range msgs {
+		observeProduced(m, now)
+	}
+	return nil
+}
+
+func (p *kafkaProducer) message(m *model.Message, data []byte) kafka.Message {
+	return kafka.Message{
+		Key:        p.keys.key(m),
+		Value:      data,
+		Headers:    headers(m),
+		WriterData: m.Ack,
+	}
+}
+
+// observeProduced считает отправку и задержку от ST (unix-секунды) до неё
+func observeProduced(m *model.Message, now time.Time) {
+	metrics.MessagesProduced.Inc()
+	if m.ST > 0 {
+		metrics.EndToEndDelay.Observe(now.Sub(time.Unix(m.ST, 0)).Seconds())
+	}
+}
+
+// ack передаёт результат записи в AckFunc исходного сообщения (если он есть)
+func ack(km kafka.Message, err error) {
+	if fn, ok := km.WriterData.(model.AckFunc); ok && fn != nil {
+		fn(err)
+	}
 }
 
 func (p *kafkaProducer) Close() error {
@@ -0,0 +1,163 @@
+package trigger
+
+import (
+	"AddressService/internal/domains/message/model"
+	"sort"
+	"time"
+)
+
+// SpeedBand — порог дистанции для скоростей от MinSpeed (км/ч) и выше
+type SpeedBand struct {
+	MinSpeed  int
+	DistanceM float64
+}
+
+// Rule — когда адрес устройства пора перезапросить
+type Rule struct {
+	SpeedBands       []SpeedBand   // берётся полоса с наибольшим MinSpeed <= скорости
+	MaxStaleness     time.Duration // 0 — адрес не устаревает по времени
+	HeadingChangeDeg int           // 0 — поворот не учитывается
+}
+
+// DefaultRule — прежняя логика: город → 300м, трасса (> 80 км/ч) → 2000м
+func DefaultRule() Rule {
+	return Rule{
+		SpeedBands: []SpeedBand{
+			{MinSpeed: 0, DistanceM: 300},
+			{MinSpeed: 81, DistanceM: 2000},
+		},
+	}
+}
+
+// RuleOverride — правило группы или устройства поверх правила по умолчанию.
+// nil — поле наследуется; явный 0 выключает MaxStaleness / HeadingChangeDeg,
+// даже если default их задаёт.
+type RuleOverride struct {
+	SpeedBands       []SpeedBand // пусто — полосы default
+	MaxStaleness     *time.Duration
+	HeadingChangeDeg *int
+}
+
+// Over накладывает переопределение на def. WithDefaults здесь не годится:
+// он вернул бы значения def в поля, явно выставленные в 0.
+func (o RuleOverride) Over(def Rule) Rule {
+	r := def
+	if len(o.SpeedBands) > 0 {
+		r.SpeedBands = sortedBands(o.SpeedBands)
+	}
+	if o.MaxStaleness != nil {
+		r.MaxStaleness = *o.MaxStaleness
+	}
+	if o.HeadingChangeDeg != nil {
+		r.HeadingChangeDeg = *o.HeadingChangeDeg
+	}
+	return r
+}
+
+// WithDefaults заполняет незаданные поля правила из def
+func (r Rule) WithDefaults(def Rule) Rule {
+	if len(r.SpeedBands) == 0 {
+		r.SpeedBands = def.SpeedBands
+	}
+	if r.MaxStaleness == 0 {
+		r.MaxStaleness = def.MaxStaleness
+	}
+	if r.HeadingChangeDeg == 0 {
+		r.HeadingChangeDeg = def.HeadingChangeDeg
+	}
+
+	r.SpeedBands = sortedBands(r.SpeedBands)
+
+	return r
+}
+
+// sortedBands — копия полос по возрастанию MinSpeed
+func sortedBands(in []SpeedBand) []SpeedBand {
+	bands := make([]SpeedBand, len(in))
+	copy(bands, in)
+	sort.Slice(bands, func(i, j int) bool { return bands[i].MinSpeed < bands[j].MinSpeed })
+	return bands
+}
+
+func (r Rule) distanceThreshold(speed int) float64 {
+	threshold := 0.0
+	for _, b := range r.SpeedBands {
+		if speed < b.MinSpeed {
+			break
+		}
+		threshold = b.DistanceM
+	}
+	return threshold
+}
+
+// shouldUpdate решает по последнему геокодированному состоянию устройства
+func (r Rule) shouldUpdate(last cachedData, newPos model.Pos, now time.Time) bool {
+	dist := DistanceMeters(last.Pos.Y, last.Pos.X, newPos.Y, newPos.X)
+	if dist >= r.distanceThreshold(newPos.S) {
+		return true
+	}
+
+	if r.MaxStaleness > 0 && now.Sub(last.UpdatedAt) >= r.MaxStaleness {
+		return true
+	}
+
+	// на стоянке азимут шумит — поворот считаем только в движении
+	if r.HeadingChangeDeg > 0 && newPos.S > 0 && headingDelta(last.Pos.A, newPos.A) >= r.HeadingChangeDeg {
+		return true
+	}
+
+	return false
+}
+
+// headingDelta — угол между двумя азимутами, 0..180
+func headingDelta(a, b int) int {
+	d := (a - b) % 360
+	if d < 0 {
+		d = -d
+	}
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// Profiles — правило по умолчанию и переопределения для групп и отдельных устройств
+type Profiles struct {
+	Default      Rule
+	Groups       map[string]Rule // имя группы → правило
+	DeviceGroups map[int64]string
+	Devices      map[int64]Rule // правило конкретного устройства важнее группы
+}
+
+// NewProfiles собирает профили; правила групп и устройств наследуют незаданное у def
+func NewProfiles(def Rule, groups map[string]RuleOverride, deviceGroups map[int64]string, devices map[int64]RuleOverride) *Profiles {
+	def = def.WithDefaults(DefaultRule())
+
+	p := &Profiles{
+		Default:      def,
+		Groups:       make(map[string]Rule, len(groups)),
+		DeviceGroups: deviceGroups,
+		Devices:      make(map[int64]Rule, len(devices)),
+	}
+	for name, r := range groups {
+		p.Groups[name] = r.Over(def)
+	}
+	for id, r := range devices {
+		p.Devices[id] = r.Over(def)
+	}
+
+	return p
+}
+
+// RuleFor — правило для устройства: своё → группы → по умолчанию
+func (p *Profiles) RuleFor(id int64) Rule {
+	if r, ok := p.Devices[id]; ok {
+		return r
+	}
+	if g, ok := p.DeviceGroups[id]; ok {
+		if r, ok := p.Groups[g]; ok {
+			return r
+		}
+	}
+	return p.Default
+}
@@ -0,0 +1,56 @@
+package trigger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRuleOverrideOver(t *testing.T) {
+	def := Rule{
+		SpeedBands:       []SpeedBand{{MinSpeed: 0, DistanceM: 300}, {MinSpeed: 81, DistanceM: 2000}},
+		MaxStaleness:     time.Minute,
+		HeadingChangeDeg: 30,
+	}
+	zeroDur, hourDur := time.Duration(0), time.Hour
+	zeroDeg, deg45 := 0, 45
+
+	tests := []struct {
+		name string
+		o    RuleOverride
+		want Rule
+	}{
+		{
+			name: "пустое переопределение наследует всё",
+			o:    RuleOverride{},
+			want: def,
+		},
+		{
+			name: "явный 0 выключает проверки",
+			o:    RuleOverride{MaxStaleness: &zeroDur, HeadingChangeDeg: &zeroDeg},
+			want: Rule{SpeedBands: def.SpeedBands},
+		},
+		{
+			name: "свои значения важнее default",
+			o:    RuleOverride{MaxStaleness: &hourDur, HeadingChangeDeg: &deg45},
+			want: Rule{SpeedBands: def.SpeedBands, MaxStaleness: time.Hour, HeadingChangeDeg: 45},
+		},
+		{
+			name: "свои полосы сортируются по скорости",
+			o:    RuleOverride{SpeedBands: []SpeedBand{{MinSpeed: 41, DistanceM: 500}, {MinSpeed: 0, DistanceM: 100}}},
+			want: Rule{
+				SpeedBands:       []SpeedBand{{MinSpeed: 0, DistanceM: 100}, {MinSpeed: 41, DistanceM: 500}},
+				MaxStaleness:     time.Minute,
+				HeadingChangeDeg: 30,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.o.Over(def); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Over() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
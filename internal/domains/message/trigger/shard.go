@@ -0,0 +1,87 @@
+package trigger
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/lru"
+	"AddressService/internal/metrics"
+	"time"
+)
+
+const (
+	evictTTL      = "ttl"
+	evictCapacity = "capacity"
+
+	DefaultShards = 64
+)
+
+// device — состояние устройства в LRU; список упорядочен по lastSeen (свежие спереди)
+type device struct {
+	data     cachedData
+	lastSeen time.Time
+}
+
+// shard — независимая часть кеша устройств со своим локом и LRU.
+// Устройство всегда попадает в один и тот же шард (shardFor).
+type shard struct {
+	*lru.Shard[int64, *device]
+}
+
+func newShard(maxDevices int) *shard {
+	return &shard{lru.NewShard[int64, *device](maxDevices)}
+}
+
+// shardIndex — шард устройства; хеш тот же, что у полос пайплайна
+func shardIndex(id int64, mask uint64) uint64 {
+	return model.DeviceHash(id) & mask
+}
+
+// touch достаёт состояние устройства и отмечает, что оно живо. Вызывать под локом шарда.
+func (s *shard) touch(id int64, now time.Time, ttl time.Duration) (cachedData, bool) {
+	d, ok := s.Get(id)
+	if !ok {
+		return cachedData{}, false
+	}
+
+	if ttl > 0 && now.Sub(d.lastSeen) >= ttl {
+		s.remove(id, evictTTL)
+		return cachedData{}, false
+	}
+
+	d.lastSeen = now
+	return d.data, true
+}
+
+// put записывает состояние устройства и соблюдает maxDevices. Вызывать под локом шарда.
+func (s *shard) put(id int64, data cachedData, lastSeen time.Time) {
+	added, evicted := s.Put(id, &device{data: data, lastSeen: lastSeen})
+	if added {
+		metrics.TriggerDevices.Inc()
+	}
+	if evicted > 0 {
+		metrics.TriggerDevices.Sub(float64(evicted))
+		metrics.TriggerEvictions.WithLabelValues(evictCapacity).Add(float64(evicted))
+	}
+}
+
+// remove убирает устройство из шарда. Вызывать под локом шарда.
+func (s *shard) remove(id int64, reason string) {
+	if s.Remove(id) {
+		metrics.TriggerDevices.Dec()
+		metrics.TriggerEvictions.WithLabelValues(reason).Inc()
+	}
+}
+
+// sweep выкидывает устройства, молчащие дольше ttl
+func (s *shard) sweep(now time.Time, ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	// хвост списка — самые давние, дальше можно не смотреть
+	for {
+		id, d, ok := s.Oldest()
+		if !ok || now.Sub(d.lastSeen) < ttl {
+			return
+		}
+		s.remove(id, evictTTL)
+	}
+}
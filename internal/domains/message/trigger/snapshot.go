@@ -0,0 +1,167 @@
+package trigger
+
+import (
+	"AddressService/internal/domains/message/model"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigFastest
+
+// snapshotRecord — одна строка снапшота (JSON lines), от самых давних к свежим
+type snapshotRecord struct {
+	ID        int64     `json:"id"`
+	Pos       model.Pos `json:"pos"`
+	Lang      string    `json:"lang,omitempty"`
+	Address   string    `json:"address"`
+	UpdatedAt int64     `json:"updated_at"` // unix ms
+	LastSeen  int64     `json:"last_seen"`  // unix ms
+}
+
+// Snapshot пишет состояние всех устройств в w
+func (t *AddressTrigger) Snapshot(w io.Writer) (int, error) {
+	// под локом шарда только копируем, кодируем уже без него
+	records := make([]snapshotRecord, 0)
+	for _, sh := range t.shards {
+		sh.Lock()
+		sh.Each(func(id int64, d *device) {
+			records = append(records, snapshotRecord{
+				ID:        id,
+				Pos:       d.data.Pos,
+				Lang:      d.data.Lang,
+				Address:   d.data.Address,
+				UpdatedAt: d.data.UpdatedAt.UnixMilli(),
+				LastSeen:  d.lastSeen.UnixMilli(),
+			})
+		})
+		sh.Unlock()
+	}
+
+	// от давних к свежим: при восстановлении с меньшим MaxDevices вытеснятся старые
+	sort.SliceStable(records, func(i, j int) bool { return records[i].LastSeen < records[j].LastSeen })
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return 0, fmt.Errorf("encode device %d: %w", records[i].ID, err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+
+	return len(records), nil
+}
+
+// Restore загружает снапшот поверх текущего состояния.
+// Устройства, просроченные по TTL, пропускаются.
+func (t *AddressTrigger) Restore(r io.Reader) (int, error) {
+	now := time.Now()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	restored, line := 0, 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec snapshotRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return restored, fmt.Errorf("decode line %d: %w", line, err)
+		}
+
+		lastSeen := time.UnixMilli(rec.LastSeen)
+		if t.eviction.TTL > 0 && now.Sub(lastSeen) >= t.eviction.TTL {
+			continue
+		}
+
+		sh := t.shardFor(rec.ID)
+		sh.Lock()
+		sh.put(rec.ID, cachedData{
+			Pos:       rec.Pos,
+			Lang:      rec.Lang,
+			Address:   rec.Address,
+			UpdatedAt: time.UnixMilli(rec.UpdatedAt),
+		}, lastSeen)
+		sh.Unlock()
+		restored++
+	}
+
+	return restored, sc.Err()
+}
+
+// SaveFile атомарно пишет снапшот: во временный файл рядом, затем rename
+func (t *AddressTrigger) SaveFile(path string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("create temp: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // после rename уже не существует
+
+	n, err := t.Snapshot(tmp)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("sync: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("close: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("rename: %w", err)
+	}
+
+	return n, nil
+}
+
+// LoadFile восстанавливает состояние из файла; отсутствие файла — не ошибка
+func (t *AddressTrigger) LoadFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	return t.Restore(f)
+}
+
+// StartSnapshots раз в interval сохраняет состояние в path, пока не вызван Close
+func (t *AddressTrigger) StartSnapshots(path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-t.stopCh:
+				return
+			case <-ticker.C:
+				if _, err := t.SaveFile(path); err != nil {
+					log.Printf("⚠️ trigger snapshot: %v", err)
+				}
+			}
+		}
+	}()
+}
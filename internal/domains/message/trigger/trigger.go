@@ -2,7 +2,24 @@ package trigger
 
 import (
 	"AddressService/internal/domains/message/model"
+	"AddressService/internal/lru"
 	"sync"
+	"time"
+)
+
+// Trigger решает, нужен ли устройству новый адрес, и помнит последний.
+// Адрес на другом языке считается устаревшим — его нужно запросить заново.
+type Trigger interface {
+	// ShouldUpdateAddress: true — пора геокодировать. Второй результат — последний
+	// известный адрес устройства на этом языке: при false он актуален, при true устарел,
+	// но годится как запасной, если геокодер недоступен ("" — адреса нет).
+	ShouldUpdateAddress(id int64, newPos model.Pos, lang string) (bool, string)
+	UpdateAddress(id int64, pos model.Pos, lang string, address string)
+}
+
+var (
+	_ Trigger = (*AddressTrigger)(nil)
+	_ Trigger = (*ReportAddressTrigger)(nil)
 )
 
 //
@@ -10,54 +27,131 @@ import (
 //
 
 type cachedData struct {
-	Pos     model.Pos
-	Address string
+	Pos       model.Pos
+	Lang      string
+	Address   string
+	UpdatedAt time.Time
+}
+
+// Eviction — ограничения на кеш устройств, чтобы он не рос бесконечно
+type Eviction struct {
+	MaxDevices    int           // 0 — без ограничения; при переполнении уходит самое давнее в шарде
+	TTL           time.Duration // 0 — без TTL; устройство, от которого так долго ничего не было, забываем
+	SweepInterval time.Duration // как часто фоновый sweeper чистит просроченные
 }
 
+// AddressTrigger — реалтайм кеш устройств, разбитый на шарды по ID,
+// чтобы 200 воркеров консьюмера не толкались на одном локе.
 type AddressTrigger struct {
-	mu         sync.RWMutex
-	lastGeoMap map[int64]cachedData
+	shards   []*shard
+	mask     uint64
+	profiles *Profiles
+	eviction Eviction
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
 }
 
-func NewAddressTrigger() *AddressTrigger {
-	return &AddressTrigger{
-		lastGeoMap: make(map[int64]cachedData),
+// NewAddressTrigger — profiles == nil означает DefaultRule для всех устройств.
+// shards округляется вверх до степени двойки (<= 0 — DefaultShards).
+// При eviction.TTL > 0 запускается фоновый sweeper, остановить его — Close.
+func NewAddressTrigger(profiles *Profiles, eviction Eviction, shards int) *AddressTrigger {
+	if profiles == nil {
+		profiles = NewProfiles(DefaultRule(), nil, nil, nil)
+	}
+	if eviction.SweepInterval <= 0 {
+		eviction.SweepInterval = time.Minute
+	}
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
 	}
-}
 
-// Реалтайм логика: город → 300м, трасса → 2000м
-func (t *AddressTrigger) ShouldUpdateAddress(id int64, newPos model.Pos) (bool, string) {
+	perShard := lru.PerShard(eviction.MaxDevices, n)
 
-	t.mu.RLock()
-	last, ok := t.lastGeoMap[id]
-	t.mu.RUnlock()
+	t := &AddressTrigger{
+		shards:   make([]*shard, n),
+		mask:     uint64(n - 1),
+		profiles: profiles,
+		eviction: eviction,
+		stopCh:   make(chan struct{}),
+	}
+	for i := range t.shards {
+		t.shards[i] = newShard(perShard)
+	}
 
-	if !ok {
-		return true, ""
+	if eviction.TTL > 0 {
+		go t.sweeper()
 	}
 
-	dist := DistanceMeters(last.Pos.Y, last.Pos.X, newPos.Y, newPos.X)
+	return t
+}
 
-	var threshold float64
-	threshold = 300 // город
-	if newPos.S > 80 {
-		threshold = 2000 // трасса
-	}
+func (t *AddressTrigger) shardFor(id int64) *shard {
+	return t.shards[shardIndex(id, t.mask)]
+}
+
+// Реалтайм логика: правило устройства (дистанция по скорости, давность, поворот)
+func (t *AddressTrigger) ShouldUpdateAddress(id int64, newPos model.Pos, lang string) (bool, string) {
+	now := time.Now()
 
-	if dist >= threshold {
+	s := t.shardFor(id)
+	s.Lock()
+	last, ok := s.touch(id, now, t.eviction.TTL)
+	s.Unlock()
+
+	if !ok || last.Lang != lang {
 		return true, ""
 	}
 
+	if t.profiles.RuleFor(id).shouldUpdate(last, newPos, now) {
+		return true, last.Address
+	}
+
 	return false, last.Address
 }
 
-func (t *AddressTrigger) UpdateAddress(id int64, pos model.Pos, address string) {
-	t.mu.Lock()
-	t.lastGeoMap[id] = cachedData{
-		Pos:     pos,
-		Address: address,
+func (t *AddressTrigger) UpdateAddress(id int64, pos model.Pos, lang string, address string) {
+	now := time.Now()
+	data := cachedData{
+		Pos:       pos,
+		Lang:      lang,
+		Address:   address,
+		UpdatedAt: now,
+	}
+
+	s := t.shardFor(id)
+	s.Lock()
+	s.put(id, data, now)
+	s.Unlock()
+}
+
+// Close останавливает sweeper и периодические снапшоты
+func (t *AddressTrigger) Close() {
+	t.closeOnce.Do(func() {
+		close(t.stopCh)
+	})
+}
+
+// sweeper периодически выкидывает устройства, молчащие дольше TTL.
+// Шарды чистятся по очереди, так что остальные в это время свободны.
+func (t *AddressTrigger) sweeper() {
+	ticker := time.NewTicker(t.eviction.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case now := <-ticker.C:
+			for _, s := range t.shards {
+				s.sweep(now, t.eviction.TTL)
+			}
+		}
 	}
-	t.mu.Unlock()
 }
 
 //
@@ -66,6 +160,7 @@ func (t *AddressTrigger) UpdateAddress(id int64, pos model.Pos, address string)
 
 type cachedReportData struct {
 	Pos     model.Pos
+	Lang    string
 	Address string
 }
 
@@ -81,28 +176,29 @@ func NewReportAddressTrigger() *ReportAddressTrigger {
 }
 
 // Отчётная логика: всегда 20 метров
-func (t *ReportAddressTrigger) ShouldUpdateAddress(id int64, newPos model.Pos) (bool, string) {
+func (t *ReportAddressTrigger) ShouldUpdateAddress(id int64, newPos model.Pos, lang string) (bool, string) {
 	t.mu.RLock()
 	last, ok := t.lastGeoMap[id]
 	t.mu.RUnlock()
 
-	if !ok {
+	if !ok || last.Lang != lang {
 		return true, ""
 	}
 
 	dist := DistanceMeters(last.Pos.Y, last.Pos.X, newPos.Y, newPos.X)
 
 	if dist >= 20 {
-		return true, ""
+		return true, last.Address
 	}
 
 	return false, last.Address
 }
 
-func (t *ReportAddressTrigger) UpdateAddress(id int64, pos model.Pos, address string) {
+func (t *ReportAddressTrigger) UpdateAddress(id int64, pos model.Pos, lang string, address string) {
 	t.mu.Lock()
 	t.lastGeoMap[id] = cachedReportData{
 		Pos:     pos,
+		Lang:    lang,
 		Address: address,
 	}
 	t.mu.Unlock()
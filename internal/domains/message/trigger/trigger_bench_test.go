@@ -0,0 +1,57 @@
+package trigger
+
+import (
+	"AddressService/internal/domains/message/model"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// Нагрузка как у консьюмера: 200 горутин, на каждое сообщение ShouldUpdateAddress
+// и UpdateAddress, если пора геокодировать. shards=1 — прежний вариант с одним локом.
+func BenchmarkAddressTrigger(b *testing.B) {
+	const workers = 200
+
+	for _, devices := range []int{100_000, 1_000_000} {
+		for _, shards := range []int{1, 16, 64, 256} {
+			b.Run(fmt.Sprintf("devices=%d/shards=%d", devices, shards), func(b *testing.B) {
+				t := NewAddressTrigger(nil, Eviction{}, shards)
+				defer t.Close()
+
+				for id := 0; id < devices; id++ {
+					t.UpdateAddress(int64(id), benchPos(id, 0), "", "addr")
+				}
+
+				// SetParallelism задаёт множитель к GOMAXPROCS
+				procs := runtime.GOMAXPROCS(0)
+				b.SetParallelism((workers + procs - 1) / procs)
+
+				var seed atomic.Int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rnd := rand.New(rand.NewSource(seed.Add(1)))
+					step := 0
+					for pb.Next() {
+						id := rnd.Intn(devices)
+						step++
+						pos := benchPos(id, step)
+						if ok, _ := t.ShouldUpdateAddress(int64(id), pos, ""); ok {
+							t.UpdateAddress(int64(id), pos, "", "addr")
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// benchPos — устройство дрейфует на ~100 м за шаг, так что часть вызовов уходит в UpdateAddress
+func benchPos(id, step int) model.Pos {
+	return model.Pos{
+		X: 76.9 + float64(id%1000)*0.001 + float64(step%50)*0.001,
+		Y: 43.2 + float64(id/1000%1000)*0.001,
+		S: 40,
+	}
+}
@@ -0,0 +1,228 @@
+package usecase
+
+import (
+	"AddressService/internal/metrics"
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig — границы AIMD-регулятора батчей геокодера.
+// При Enabled == false размер батча и число батчей в полёте фиксированы
+// на стартовых значениях (100 и 10), как было раньше.
+type AdaptiveConfig struct {
+	Enabled bool
+
+	MinBatch, MaxBatch       int
+	MinParallel, MaxParallel int
+	BatchStep                int // на сколько растёт батч за удачное окно
+
+	TargetLatency time.Duration // средняя латентность окна выше — сбрасываем вдвое
+	MaxErrorRate  float64       // доля упавших батчей окна выше — сбрасываем вдвое
+	Interval      time.Duration // длина окна
+}
+
+const (
+	defaultBatchSize   = 100
+	defaultGeoParallel = 10
+)
+
+// adaptiveController — AIMD: пока геокодер отвечает быстро и без ошибок,
+// батч растёт на BatchStep, а параллелизм на 1; плохое окно — оба делятся пополам.
+// Растём только под нагрузкой: батч — если батчи уходили полными,
+// параллелизм — если кто-то ждал свободного слота.
+type adaptiveController struct {
+	cfg AdaptiveConfig
+	sem *dynamicSemaphore
+
+	mu        sync.Mutex
+	batchSize int
+
+	// статистика текущего окна
+	calls      int
+	errors     int
+	latencySum time.Duration
+	fullBatch  bool
+}
+
+func newAdaptiveController(cfg AdaptiveConfig) *adaptiveController {
+	if !cfg.Enabled {
+		cfg.MinBatch, cfg.MaxBatch = defaultBatchSize, defaultBatchSize
+		cfg.MinParallel, cfg.MaxParallel = defaultGeoParallel, defaultGeoParallel
+	}
+	if cfg.MinBatch <= 0 {
+		cfg.MinBatch = 1
+	}
+	if cfg.MaxBatch < cfg.MinBatch {
+		cfg.MaxBatch = cfg.MinBatch
+	}
+	if cfg.MinParallel <= 0 {
+		cfg.MinParallel = 1
+	}
+	if cfg.MaxParallel < cfg.MinParallel {
+		cfg.MaxParallel = cfg.MinParallel
+	}
+	if cfg.BatchStep <= 0 {
+		cfg.BatchStep = 10
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = 300 * time.Millisecond
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	c := &adaptiveController{
+		cfg:       cfg,
+		batchSize: clampInt(defaultBatchSize, cfg.MinBatch, cfg.MaxBatch),
+	}
+	c.sem = newDynamicSemaphore(clampInt(defaultGeoParallel, cfg.MinParallel, cfg.MaxParallel))
+	c.publish(c.batchSize, c.sem.Limit())
+
+	return c
+}
+
+// BatchSize — сколько сообщений копить в батч сейчас
+func (c *adaptiveController) BatchSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batchSize
+}
+
+// observe учитывает один вызов геокодера
+func (c *adaptiveController) observe(latency time.Duration, size int, failed bool) {
+	c.mu.Lock()
+	c.calls++
+	c.latencySum += latency
+	if failed {
+		c.errors++
+	}
+	if size >= c.batchSize {
+		c.fullBatch = true
+	}
+	c.mu.Unlock()
+}
+
+// run раз в окно пересчитывает пределы, пока не закрыт stop
+func (c *adaptiveController) run(stop <-chan struct{}) {
+	if !c.cfg.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.adjust()
+		}
+	}
+}
+
+func (c *adaptiveController) adjust() {
+	waited := c.sem.resetWaited()
+
+	c.mu.Lock()
+	calls, errs, sum, full := c.calls, c.errors, c.latencySum, c.fullBatch
+	c.calls, c.errors, c.latencySum, c.fullBatch = 0, 0, 0, false
+
+	if calls == 0 {
+		c.mu.Unlock()
+		return
+	}
+
+	batch, parallel := c.batchSize, c.sem.Limit()
+	avg := sum / time.Duration(calls)
+	errRate := float64(errs) / float64(calls)
+
+	if avg > c.cfg.TargetLatency || errRate > c.cfg.MaxErrorRate {
+		// multiplicative decrease
+		batch = clampInt(batch/2, c.cfg.MinBatch, c.cfg.MaxBatch)
+		parallel = clampInt(parallel/2, c.cfg.MinParallel, c.cfg.MaxParallel)
+	} else {
+		// additive increase
+		if full {
+			batch = clampInt(batch+c.cfg.BatchStep, c.cfg.MinBatch, c.cfg.MaxBatch)
+		}
+		if waited {
+			parallel = clampInt(parallel+1, c.cfg.MinParallel, c.cfg.MaxParallel)
+		}
+	}
+
+	c.batchSize = batch
+	c.mu.Unlock()
+
+	c.sem.SetLimit(parallel)
+	c.publish(batch, parallel)
+}
+
+func (c *adaptiveController) publish(batch, parallel int) {
+	metrics.GeocoderBatchLimit.Set(float64(batch))
+	metrics.GeocoderParallelLimit.Set(float64(parallel))
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// dynamicSemaphore — семафор, у которого предел можно менять на ходу.
+// Уменьшение не отбирает уже выданные слоты, просто новые ждут, пока освободится лишнее.
+type dynamicSemaphore struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	inUse  int
+	waited bool // кто-то ждал слот с прошлого resetWaited
+}
+
+func newDynamicSemaphore(limit int) *dynamicSemaphore {
+	s := &dynamicSemaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *dynamicSemaphore) Acquire() {
+	s.mu.Lock()
+	for s.inUse >= s.limit {
+		s.waited = true
+		s.cond.Wait()
+	}
+	s.inUse++
+	s.mu.Unlock()
+}
+
+func (s *dynamicSemaphore) Release() {
+	s.mu.Lock()
+	s.inUse--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *dynamicSemaphore) SetLimit(n int) {
+	s.mu.Lock()
+	s.limit = n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *dynamicSemaphore) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+func (s *dynamicSemaphore) resetWaited() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.waited
+	s.waited = false
+	return w
+}
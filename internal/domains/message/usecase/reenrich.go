@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"AddressService/internal/domains/message/model"
+	"AddressService/internal/metrics"
+	"time"
+)
+
+// ReenrichPolicy — повторное обогащение сообщений, опубликованных как skipped_overload.
+// Через Delay копия сообщения снова идёт в геокодер и публикуется ещё раз
+// с reenriched=true; оригинал из Kafka к этому моменту уже подтверждён.
+type ReenrichPolicy struct {
+	Enabled   bool
+	Delay     time.Duration // пауза, чтобы перегрузка успела схлынуть
+	QueueSize int           // переполнилась — копия не ставится, оригинал остаётся как есть
+}
+
+type reenrichItem struct {
+	msg *model.Message
+	at  time.Time
+}
+
+// scheduleReenrich ставит копию пропущенного сообщения в очередь переобогащения
+func (u *messageUseCase) scheduleReenrich(m *model.Message) {
+	if u.reenrichQ == nil || m.Reenriched {
+		return
+	}
+
+	cp := *m
+	cp.Ack = nil // оффсет исходного сообщения закрывает оригинал, не копия
+	cp.Reenriched = true
+	cp.Enrichment = ""
+
+	select {
+	case u.reenrichQ <- reenrichItem{msg: &cp, at: time.Now().Add(u.reenrich.Delay)}:
+		metrics.Reenrich.WithLabelValues("queued").Inc()
+	default:
+		metrics.Reenrich.WithLabelValues("dropped").Inc()
+	}
+}
+
+// reenrichWorker выдерживает паузу и возвращает копии в полосы их устройств.
+// Пауза у всех одинаковая, так что очередь уже упорядочена по времени.
+// Копия выходит позже более новых сообщений устройства — по флагу reenriched
+// потребитель отличает её от живого потока.
+func (u *messageUseCase) reenrichWorker() {
+	defer u.bgWG.Done()
+
+	for {
+		select {
+		case <-u.stopCh:
+			// копии — best effort, на остановке их не ждём
+			return
+		case item := <-u.reenrichQ:
+			if d := time.Until(item.at); d > 0 {
+				t := time.NewTimer(d)
+				select {
+				case <-u.stopCh:
+					t.Stop()
+					return
+				case <-t.C:
+				}
+			}
+			u.requeue(item.msg)
+		}
+	}
+}
+
+// requeue кладёт копию в полосу устройства, если usecase ещё работает и в полосе есть место
+func (u *messageUseCase) requeue(m *model.Message) {
+	u.closeMu.RLock()
+	defer u.closeMu.RUnlock()
+	if u.closed {
+		return
+	}
+
+	select {
+	case u.lanes[model.LaneOf(m.ID, len(u.lanes))] <- m:
+		metrics.Reenrich.WithLabelValues("requeued").Inc()
+	default:
+		metrics.Reenrich.WithLabelValues("dropped").Inc()
+	}
+}
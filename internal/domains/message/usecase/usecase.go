@@ -1,145 +1,527 @@
 package usecase
 
 import (
+	"AddressService/internal/domains/message/cache"
 	"AddressService/internal/domains/message/model"
 	"AddressService/internal/domains/message/repository/geocoder"
 	"AddressService/internal/domains/message/repository/kafka"
 	"AddressService/internal/domains/message/trigger"
+	"AddressService/internal/metrics"
 	"context"
+	"errors"
+	"sort"
 	"sync"
 	"time"
 )
 
+// lookupTimeout — предел одной попытки геокодера из полосы
+const lookupTimeout = 1 * time.Second
+
+var (
+	// ErrClosed — usecase остановлен и новые сообщения не принимает
+	ErrClosed = errors.New("message usecase is closed")
+
+	// ErrRateLimited — квота геокодера исчерпана; /report отвечает на это 429
+	ErrRateLimited = geocoder.ErrRateLimited
+)
+
 type MessageUseCase interface {
 	ProcessMessage(ctx context.Context, msg *model.Message) error
-	ProcessMessages(ctx context.Context, msgs []*model.Message) ([]*model.Message, error)
+	ProcessMessages(ctx context.Context, msgs []*model.Message, opts ReportOptions) ([]*model.Message, error)
 	Close()
 }
 
+// ReportOptions — параметры запроса /report
+type ReportOptions struct {
+	// SortByDevice — вернуть ответ отсортированным по ID, затем по DT.
+	// Без него порядок ответа совпадает с порядком запроса.
+	SortByDevice bool
+}
+
 type messageUseCase struct {
-	trigger      *trigger.AddressTrigger
+	trigger      trigger.Trigger
 	producer     kafka.KafkaProducer
-	geocoder     *geocoder.Geocoder // 👈 передаётся извне
-	geoQueue     chan *model.Message
+	geocoder     geocoder.ReverseGeocoder // 👈 передаётся извне
+	spatial      *cache.GridCache         // nil — общий кеш по ячейкам выключен
+	lanes        []chan *model.Message    // полоса на группу устройств: ID → LaneOf → одна горутина
 	produceQueue chan *model.Message
-	wg           sync.WaitGroup
-	stopCh       chan struct{}
+	reenrichQ    chan reenrichItem // nil — пропущенные под нагрузкой не переобогащаются
+	stopCh       chan struct{}     // останавливает reenrichWorker и регулятор батчей
+	draining     chan struct{}     // закрывается в начале Close: повторы геокодера больше не ждут
 
-	batchSize   int
-	batchWait   time.Duration
-	geoParallel int
+	// порядок остановки: lanes → фон → produce, у каждого этапа свой WaitGroup
+	laneWG    sync.WaitGroup
+	bgWG      sync.WaitGroup
+	produceWG sync.WaitGroup
+
+	closeMu   sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+
+	batchWait time.Duration
+	adaptive  *adaptiveController // размер батча и число батчей в полёте
+
+	retry    RetryPolicy
+	reenrich ReenrichPolicy
 }
 
-// 👇 теперь принимаем готовый geocoder
-func NewMessageUseCase(trigger *trigger.AddressTrigger, producer kafka.KafkaProducer, geo *geocoder.Geocoder) MessageUseCase {
+// RetryPolicy — сколько раз и как часто повторять батч, на котором упал геокодер
+type RetryPolicy struct {
+	MaxAttempts int           // всего попыток, включая первую; в полосе — сколько влезет в MaxElapsed
+	BaseBackoff time.Duration // пауза после первой неудачи, дальше удваивается
+	MaxBackoff  time.Duration // потолок паузы
+	MaxElapsed  time.Duration // потолок на все попытки батча полосы: дольше полоса не стоит
+}
+
+// 👇 теперь принимаем любой geocoder, реализующий ReverseGeocoder
+func NewMessageUseCase(trigger trigger.Trigger, producer kafka.KafkaProducer, geo geocoder.ReverseGeocoder, spatial *cache.GridCache, retry RetryPolicy, adaptive AdaptiveConfig, reenrich ReenrichPolicy) MessageUseCase {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 1
+	}
+	if retry.BaseBackoff <= 0 {
+		retry.BaseBackoff = 200 * time.Millisecond
+	}
+	if retry.MaxBackoff < retry.BaseBackoff {
+		retry.MaxBackoff = retry.BaseBackoff
+	}
+	if retry.MaxElapsed <= 0 {
+		retry.MaxElapsed = 3 * time.Second
+	}
+
 	u := &messageUseCase{
 		trigger:      trigger,
 		producer:     producer,
 		geocoder:     geo, // 👈 сохраняем сюда
-		geoQueue:     make(chan *model.Message, 10_000),
+		spatial:      spatial,
 		produceQueue: make(chan *model.Message, 10_000),
 		stopCh:       make(chan struct{}),
+		draining:     make(chan struct{}),
+
+		batchWait: 100 * time.Millisecond,
+		adaptive:  newAdaptiveController(adaptive),
 
-		batchSize:   100,
-		batchWait:   100 * time.Millisecond,
-		geoParallel: 10,
+		retry:    retry,
+		reenrich: reenrich,
+	}
+	if reenrich.Enabled {
+		if u.reenrich.QueueSize <= 0 {
+			u.reenrich.QueueSize = 10_000
+		}
+		u.reenrichQ = make(chan reenrichItem, u.reenrich.QueueSize)
 	}
 
-	// геокодер pool
-	for i := 0; i < u.geoParallel; i++ {
-		u.wg.Add(1)
-		go u.geoWorkerBatch()
+	// полосы: сообщения одного устройства всегда попадают в одну и ту же,
+	// поэтому выходят из неё в том порядке, в котором пришли.
+	// Полос по верхней границе, в геокодер одновременно ходит столько,
+	// сколько сейчас разрешает регулятор
+	u.lanes = make([]chan *model.Message, u.adaptive.cfg.MaxParallel)
+	perLane := 10_000 / len(u.lanes)
+	if perLane < 100 {
+		perLane = 100
+	}
+	for i := range u.lanes {
+		u.lanes[i] = make(chan *model.Message, perLane)
+		u.laneWG.Add(1)
+		go u.laneWorker(u.lanes[i])
 	}
+	go u.adaptive.run(u.stopCh)
 
-	// продюсер pool
-	u.wg.Add(1)
+	// переобогащение пропущенных под нагрузкой
+	if u.reenrichQ != nil {
+		u.bgWG.Add(1)
+		go u.reenrichWorker()
+	}
+
+	// продюсер один: порядок, заданный полосами, сохраняется до writer'а
+	u.produceWG.Add(1)
 	go u.produceWorker()
 
 	return u
 }
 
+// Close перестаёт принимать сообщения и дожидается, пока всё принятое
+// пройдёт геокодер и уйдёт в Kafka. Повторный вызов ничего не делает.
 func (u *messageUseCase) Close() {
-	close(u.stopCh)
-	close(u.geoQueue)
-	u.wg.Wait()
-	close(u.produceQueue)
-	_ = u.producer.Close()
+	u.closeOnce.Do(func() {
+		// повторы геокодера больше не ждут паузу — одна попытка и дальше
+		close(u.draining)
+
+		// после этого никто не пишет в полосы
+		u.closeMu.Lock()
+		u.closed = true
+		for _, q := range u.lanes {
+			close(q)
+		}
+		u.closeMu.Unlock()
+
+		// полосы дочитывают очереди и сбрасывают свои батчи
+		u.laneWG.Wait()
+
+		close(u.stopCh)
+		u.bgWG.Wait()
+
+		close(u.produceQueue)
+		u.produceWG.Wait()
+
+		// async writer дописывает буфер и вызывает Completion
+		if err := u.producer.Close(); err != nil {
+			println("⚠️ producer close:", err.Error())
+		}
+	})
 }
 
-// ----------- GEOCODER WORKER (BATCH) -----------
+// ----------- DEVICE LANES -----------
 
-func (u *messageUseCase) geoWorkerBatch() {
-	defer u.wg.Done()
+// laneWorker — одна полоса: сообщения её устройств копятся в батч, геокодируются
+// одним запросом и уходят продюсеру строго в порядке поступления.
+// Сообщения с готовым адресом ждут в том же батче, чтобы не обогнать соседей.
+func (u *messageUseCase) laneWorker(q chan *model.Message) {
+	defer u.laneWG.Done()
 
 	ticker := time.NewTicker(u.batchWait)
 	defer ticker.Stop()
 
-	batch := make([]*model.Message, 0, u.batchSize)
+	batch := make([]*model.Message, 0, u.adaptive.BatchSize())
+	pending := 0 // сколько сообщений батча ждут геокодер
 
 	flush := func() {
 		if len(batch) == 0 {
 			return
 		}
+		u.flushLane(q, batch)
+		batch = batch[:0]
+		pending = 0
+	}
+
+	for {
+		select {
+		case msg, ok := <-q:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if needsGeocode(msg) {
+				pending++
+			}
+			// без геокодирования батч не копим: отдаём сразу, как только он без долгов
+			if pending == 0 || pending >= u.adaptive.BatchSize() {
+				flush()
+			}
 
-		positions := make([]model.Pos, len(batch))
-		for i, m := range batch {
-			positions[i] = m.Pos
+		case <-ticker.C:
+			flush()
 		}
+	}
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-		addrs, err := u.geocoder.GetAddresses(ctx, positions) // 👈 теперь через экземпляр
-		cancel()
+// needsGeocode — статус ещё не выставлен, значит адрес ждёт геокодер
+func needsGeocode(m *model.Message) bool {
+	return m.Enrichment == ""
+}
 
-		if err != nil {
-			println("❌ geoWorkerBatch: geocoder error:", err.Error())
-			batch = batch[:0]
-			return
+// flushLane геокодирует ждущие сообщения батча и публикует весь батч по порядку.
+// Если за батчем уже скопилось полполосы, повторов не будет: одна попытка,
+// иначе стоящая полоса упрётся в консьюмер и остановит чтение из Kafka.
+func (u *messageUseCase) flushLane(q chan *model.Message, batch []*model.Message) {
+	attempts := u.retry.MaxAttempts
+	if len(q) >= cap(q)/2 {
+		attempts = 1
+	}
+
+	toGeocode := make([]*model.Message, 0, len(batch))
+	for _, m := range batch {
+		if needsGeocode(m) {
+			toGeocode = append(toGeocode, m)
 		}
+	}
 
-		for i, m := range batch {
-			addr := ""
-			if i < len(addrs) {
-				addr = addrs[i]
-			}
-			m.Address = addr
-			u.trigger.UpdateAddress(m.ID, m.Pos, addr)
+	// язык уходит в геокодер на весь запрос, поэтому батч делится по языкам
+	if len(toGeocode) > 0 {
+		for _, group := range splitByLang(toGeocode) {
+			u.geocodeGroup(group, attempts)
+		}
+	}
 
-			select {
-			case u.produceQueue <- m:
-			case <-u.stopCh:
-				return
+	for _, m := range batch {
+		if m.Reenriched && m.Enrichment != model.EnrichmentFresh {
+			// оригинал уже опубликован, копия без свежего адреса ничего не добавит
+			metrics.Reenrich.WithLabelValues("dropped").Inc()
+			continue
+		}
+		u.emit(m)
+	}
+}
+
+// splitByLang делит батч на группы с одним языком, сохраняя порядок внутри группы.
+// Обычно язык у всех один — тогда батч возвращается как есть.
+func splitByLang(msgs []*model.Message) [][]*model.Message {
+	mixed := false
+	for _, m := range msgs[1:] {
+		if m.Lang != msgs[0].Lang {
+			mixed = true
+			break
+		}
+	}
+	if !mixed {
+		return [][]*model.Message{msgs}
+	}
+
+	groups := make([][]*model.Message, 0, 2)
+	index := make(map[string]int, 2)
+	for _, m := range msgs {
+		i, ok := index[m.Lang]
+		if !ok {
+			i = len(groups)
+			index[m.Lang] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+	return groups
+}
+
+// geocodeGroup проставляет адреса и статусы сообщениям одного языка.
+// Повторы идут на месте (lookupWithRetry): асинхронная очередь повторов
+// выпустила бы сообщение позже более новых сообщений того же устройства.
+// Все попытки вместе укладываются в RetryPolicy.MaxElapsed.
+func (u *messageUseCase) geocodeGroup(msgs []*model.Message, attempts int) {
+	positions := make([]model.Pos, len(msgs))
+	for i, m := range msgs {
+		positions[i] = m.Pos
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.retry.MaxElapsed)
+	addrs, err := u.lookupWithRetry(ctx, positions, msgs[0].Lang, true, attempts)
+	cancel()
+	if errors.Is(err, geocoder.ErrRateLimited) {
+		for _, m := range msgs {
+			u.markSkipped(m)
+		}
+		return
+	}
+	if err != nil {
+		println("❌ geocodeGroup: geocoder error after retries:", err.Error())
+		for _, m := range msgs {
+			markFailed(m)
+		}
+		return
+	}
+
+	for i, m := range msgs {
+		res := addrs[i]
+		if res.Err != nil {
+			markFailed(m)
+			continue
+		}
+		m.Address = res.Address
+		m.AddressDetails = res.Details
+		m.Enrichment = enrichmentOf(res)
+		m.Provider = res.Provider
+		if m.Reenriched {
+			// позиция копии уже не последняя у устройства — триггер не откатываем
+			if u.spatial != nil && res.Provider != geocoder.ProviderCoordinates {
+				u.spatial.Put(m.Pos, m.Lang, res.Address, res.Details)
 			}
+		} else {
+			u.remember(m.ID, m.Pos, m.Lang, res)
 		}
+	}
+}
 
-		batch = batch[:0]
+// markSkipped — геокодер пропущен из-за перегрузки или квоты: остаётся прошлый адрес
+// устройства (его ProcessMessage положил в Address до постановки в полосу)
+func (u *messageUseCase) markSkipped(m *model.Message) {
+	if m.Reenriched {
+		return // flushLane такую копию не опубликует
 	}
+	m.Enrichment = model.EnrichmentSkippedOverload
+	u.scheduleReenrich(m)
+}
 
-	for {
-		select {
-		case <-u.stopCh:
-			flush()
-			return
+// enrichmentOf — статус успешного ответа: координаты-заглушка из fallback адресом не считаются
+func enrichmentOf(res geocoder.Result) string {
+	if res.Provider == geocoder.ProviderCoordinates {
+		return model.EnrichmentCoordinates
+	}
+	return model.EnrichmentFresh
+}
 
-		case msg, ok := <-u.geoQueue:
-			if !ok {
-				flush()
-				return
+// markFailed — геокодер так и не ответил: публикуем без адреса с флагом address_error
+func markFailed(m *model.Message) {
+	m.Address = ""
+	m.AddressDetails = nil
+	m.AddressError = true
+	m.Enrichment = model.EnrichmentFailed
+}
+
+// lookup — вызов геокодера с замером латентности и ошибок.
+// При err == nil гарантирует len(result) == len(positions): несовпадение — ошибка батча.
+// lane — батч полосы: идёт под семафором регулятора и попадает в его окно.
+// /report (lane == false) шлёт весь отчёт одним вызовом — его многосекундная
+// латентность не про размер батча и не должна урезать Kafka-путь.
+// Метрики геокодера пишутся для обоих путей.
+func (u *messageUseCase) lookup(ctx context.Context, positions []model.Pos, lang string, lane bool) ([]geocoder.Result, error) {
+	if lane {
+		u.adaptive.sem.Acquire()
+	}
+	start := time.Now()
+	addrs, err := geocoder.Lookup(ctx, u.geocoder, positions, lang)
+	elapsed := time.Since(start)
+	if lane {
+		u.adaptive.sem.Release()
+	}
+
+	if errors.Is(err, geocoder.ErrRateLimited) {
+		// геокодер не спрашивали — ни латентности, ни ошибки бэкенда тут нет
+		metrics.GeocoderRateLimited.Add(float64(len(positions)))
+		return nil, err
+	}
+
+	if lane {
+		u.adaptive.observe(elapsed, len(positions), err != nil)
+	}
+	metrics.GeocoderBatchDuration.Observe(elapsed.Seconds())
+	metrics.GeocoderBatchSize.Observe(float64(len(positions)))
+
+	if err != nil {
+		metrics.GeocoderErrors.Inc()
+		if errors.Is(err, geocoder.ErrLengthMismatch) {
+			metrics.GeocoderLengthMismatch.Inc()
+		}
+		return nil, err
+	}
+
+	itemErrors := 0
+	for _, r := range addrs {
+		if r.Err != nil {
+			itemErrors++
+		}
+	}
+	if itemErrors > 0 {
+		metrics.GeocoderItemErrors.Add(float64(itemErrors))
+	}
+
+	return addrs, nil
+}
+
+// lookupWithRetry — батч и упавшие позиции повторяются на месте с паузами RetryPolicy,
+// пока не кончатся attempts, ctx или usecase не начнёт останавливаться.
+// В полосе (lane) каждая попытка ограничена lookupTimeout; /report живёт
+// в контексте запроса — его отчёт уходит в геокодер десятками POST'ов подряд.
+// Позиции, так и не получившие адрес, возвращаются с Result.Err.
+func (u *messageUseCase) lookupWithRetry(ctx context.Context, positions []model.Pos, lang string, lane bool, attempts int) ([]geocoder.Result, error) {
+	var results []geocoder.Result
+	pending := make([]int, len(positions)) // индексы позиций, которые ещё нужно спросить
+	for i := range pending {
+		pending[i] = i
+	}
+
+	backoff := u.retry.BaseBackoff
+	for attempt := 1; ; attempt++ {
+		batch := make([]model.Pos, len(pending))
+		for k, i := range pending {
+			batch[k] = positions[i]
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if lane {
+			attemptCtx, cancel = context.WithTimeout(ctx, lookupTimeout)
+		}
+		addrs, err := u.lookup(attemptCtx, batch, lang, lane)
+		cancel()
+		if err == nil {
+			if results == nil {
+				results = addrs
+			} else {
+				for k, i := range pending {
+					results[i] = addrs[k]
+				}
 			}
-			batch = append(batch, msg)
-			if len(batch) >= u.batchSize {
-				flush()
+
+			still := pending[:0]
+			for _, i := range pending {
+				if results[i].Err != nil {
+					still = append(still, i)
+				}
+			}
+			pending = still
+			if len(pending) == 0 {
+				return results, nil
+			}
+		}
+
+		if errors.Is(err, geocoder.ErrRateLimited) {
+			return nil, err
+		}
+		if attempt >= attempts {
+			if results == nil {
+				return nil, err
 			}
+			return results, nil
+		}
 
-		case <-ticker.C:
-			flush()
+		select {
+		case <-ctx.Done():
+			if results == nil {
+				return nil, ctx.Err()
+			}
+			return results, nil
+		case <-u.draining:
+			// остановка: не держим полосы паузами, отдаём что есть
+			if results == nil {
+				return nil, err
+			}
+			return results, nil
+		case <-time.After(backoff):
 		}
+		if backoff *= 2; backoff > u.retry.MaxBackoff {
+			backoff = u.retry.MaxBackoff
+		}
+	}
+}
+
+func observeTrigger(shouldGeocode bool) {
+	if shouldGeocode {
+		metrics.TriggerDecisions.WithLabelValues("miss").Inc()
+	} else {
+		metrics.TriggerDecisions.WithLabelValues("hit").Inc()
+	}
+}
+
+// observeQueues снимает глубину очередей для /metrics
+func (u *messageUseCase) observeQueues() {
+	lanes := 0
+	for _, q := range u.lanes {
+		lanes += len(q)
 	}
+	metrics.QueueDepth.WithLabelValues("geo").Set(float64(lanes))
+	metrics.QueueDepth.WithLabelValues("produce").Set(float64(len(u.produceQueue)))
+}
+
+// remember кладёт свежий адрес в триггер и общий кеш.
+// Координаты-заглушку из fallback не кешируем: следующее сообщение снова спросит геокодер.
+func (u *messageUseCase) remember(id int64, pos model.Pos, lang string, res geocoder.Result) {
+	if res.Provider == geocoder.ProviderCoordinates {
+		return
+	}
+	u.trigger.UpdateAddress(id, pos, lang, res.Address)
+	if u.spatial != nil {
+		u.spatial.Put(pos, lang, res.Address, res.Details)
+	}
+}
+
+// emit отдаёт сообщение в очередь продюсера.
+// produceQueue закрывается последним, поэтому блокирующая отправка безопасна.
+func (u *messageUseCase) emit(m *model.Message) {
+	metrics.EnrichmentStatus.WithLabelValues(m.Enrichment).Inc()
+	u.produceQueue <- m
 }
 
 // ----------- PRODUCER WORKER -----------
 
 func (u *messageUseCase) produceWorker() {
-	defer u.wg.Done()
+	defer u.produceWG.Done()
 
 	const batchSize = 500
 	ticker := time.NewTicker(200 * time.Millisecond)
@@ -159,16 +541,6 @@ func (u *messageUseCase) produceWorker() {
 
 	for {
 		select {
-		case <-u.stopCh:
-			for m := range u.produceQueue {
-				batch = append(batch, m)
-				if len(batch) >= batchSize {
-					flush()
-				}
-			}
-			flush()
-			return
-
 		case m, ok := <-u.produceQueue:
 			if !ok {
 				flush()
@@ -180,6 +552,7 @@ func (u *messageUseCase) produceWorker() {
 			}
 
 		case <-ticker.C:
+			u.observeQueues()
 			flush()
 		}
 	}
@@ -188,61 +561,140 @@ func (u *messageUseCase) produceWorker() {
 // ----------- ENTRY POINTS -----------
 
 func (u *messageUseCase) ProcessMessage(ctx context.Context, msg *model.Message) error {
-	shouldGeocode, cached := u.trigger.ShouldUpdateAddress(msg.ID, msg.Pos)
-
-	if shouldGeocode {
-		local := *msg
-		select {
-		case u.geoQueue <- &local:
-			return nil
-		case <-u.stopCh:
-			return context.Canceled
-		default:
-			local.Address = cached
-			return u.producer.Produce(ctx, &local)
-		}
+	// RLock держим до конца: Close не закроет полосы посреди отправки
+	u.closeMu.RLock()
+	defer u.closeMu.RUnlock()
+	if u.closed {
+		return ErrClosed
 	}
 
+	shouldGeocode, cached := u.trigger.ShouldUpdateAddress(msg.ID, msg.Pos, msg.Lang)
+	observeTrigger(shouldGeocode)
+
 	local := *msg
+	local.ResetEnrichment()
+	// при геокодировании прошлый адрес — запасной, если квота геокодера кончится;
+	// успешный ответ его заменит
 	local.Address = cached
-	return u.producer.Produce(ctx, &local)
+	if !shouldGeocode {
+		local.Enrichment = model.EnrichmentCached
+	} else if u.spatial != nil {
+		// соседняя машина уже была в этой ячейке — геокодер не нужен
+		if addr, details, ok := u.spatial.Get(local.Pos, local.Lang); ok {
+			local.Address = addr
+			local.AddressDetails = details
+			local.Enrichment = model.EnrichmentCached
+			u.trigger.UpdateAddress(local.ID, local.Pos, local.Lang, addr)
+		}
+	}
+
+	// даже готовый адрес идёт через полосу устройства: напрямую в продюсер
+	// он обогнал бы более ранние сообщения, ждущие геокодер
+	lane := u.lanes[model.LaneOf(local.ID, len(u.lanes))]
+	if needsGeocode(&local) && len(lane) == cap(lane) {
+		// полоса переполнена — геокодер пропускаем, публикуем с прошлым адресом и честным статусом
+		local.Enrichment = model.EnrichmentSkippedOverload
+		u.scheduleReenrich(&local)
+	}
+
+	select {
+	case lane <- &local:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (u *messageUseCase) ProcessMessages(ctx context.Context, msgs []*model.Message) ([]*model.Message, error) {
-	results := make([]*model.Message, 0, len(msgs))
+// ProcessMessages обогащает исторический отчёт. Триггер у каждого запроса свой
+// (ReportAddressTrigger, 20 м), поэтому отчёт не трогает реалтайм кеш устройств.
+// Ответ идёт в порядке запроса (или ID+DT при opts.SortByDevice).
+func (u *messageUseCase) ProcessMessages(ctx context.Context, msgs []*model.Message, opts ReportOptions) ([]*model.Message, error) {
+	reportTrigger := trigger.NewReportAddressTrigger()
+
+	if opts.SortByDevice {
+		// сортируем до триггера: опорные точки считаются по хронологии устройства
+		sorted := make([]*model.Message, len(msgs))
+		copy(sorted, msgs)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if sorted[i].ID != sorted[j].ID {
+				return sorted[i].ID < sorted[j].ID
+			}
+			return sorted[i].DT < sorted[j].DT
+		})
+		msgs = sorted
+	}
+
+	results := make([]*model.Message, len(msgs))
 
 	toGeocode := make([]*model.Message, 0, len(msgs))
-	positions := make([]model.Pos, 0, len(msgs))
 
-	for _, msg := range msgs {
+	// сообщения в пределах 20 м от опорной точки берут её адрес;
+	// адрес опорной точки станет известен только после геокодирования
+	anchorOf := make(map[int64]*model.Message)
+	followers := make([]*model.Message, 0, len(msgs))
+	followerAnchor := make([]*model.Message, 0, len(msgs))
+
+	for i, msg := range msgs {
 		local := *msg
-		shouldGeocode, cached := u.trigger.ShouldUpdateAddress(local.ID, local.Pos)
-		if shouldGeocode {
+		local.ResetEnrichment()
+		results[i] = &local
+		if shouldGeocode, _ := reportTrigger.ShouldUpdateAddress(local.ID, local.Pos, local.Lang); shouldGeocode {
+			reportTrigger.UpdateAddress(local.ID, local.Pos, local.Lang, "")
+			anchorOf[local.ID] = &local
+			if u.spatial != nil {
+				if addr, details, ok := u.spatial.Get(local.Pos, local.Lang); ok {
+					local.Address = addr
+					local.AddressDetails = details
+					local.Enrichment = model.EnrichmentCached
+					continue
+				}
+			}
 			toGeocode = append(toGeocode, &local)
-			positions = append(positions, local.Pos)
 		} else {
-			local.Address = cached
-			results = append(results, &local)
+			followers = append(followers, &local)
+			followerAnchor = append(followerAnchor, anchorOf[local.ID])
 		}
 	}
 
-	if len(toGeocode) == 0 {
-		return results, nil
-	}
+	if len(toGeocode) > 0 {
+		for _, group := range splitByLang(toGeocode) {
+			positions := make([]model.Pos, len(group))
+			for i, msg := range group {
+				positions[i] = msg.Pos
+			}
 
-	addrs, err := u.geocoder.GetAddresses(ctx, positions) // 👈 тоже через u.geocoder
-	if err != nil {
-		return results, err
+			addrs, err := u.lookupWithRetry(ctx, positions, group[0].Lang, false, u.retry.MaxAttempts)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, msg := range group {
+				res := addrs[i]
+				if res.Err != nil {
+					// ведомые точки возьмут пустой адрес и флаг от опорной
+					msg.AddressError = true
+					msg.Enrichment = model.EnrichmentFailed
+					continue
+				}
+				msg.Address = res.Address
+				msg.AddressDetails = res.Details
+				msg.Enrichment = enrichmentOf(res)
+				if u.spatial != nil && res.Provider != geocoder.ProviderCoordinates {
+					u.spatial.Put(msg.Pos, msg.Lang, res.Address, res.Details)
+				}
+			}
+		}
 	}
 
-	for i, msg := range toGeocode {
-		addr := ""
-		if i < len(addrs) {
-			addr = addrs[i]
+	for i, msg := range followers {
+		msg.Address = followerAnchor[i].Address
+		msg.AddressDetails = followerAnchor[i].AddressDetails
+		msg.AddressError = followerAnchor[i].AddressError
+		msg.Enrichment = model.EnrichmentCached
+		if a := followerAnchor[i].Enrichment; a == model.EnrichmentFailed || a == model.EnrichmentCoordinates {
+			// у опорной нет настоящего адреса — и у ведомой тоже
+			msg.Enrichment = a
 		}
-		msg.Address = addr
-		u.trigger.UpdateAddress(msg.ID, msg.Pos, addr)
-		results = append(results, msg)
 	}
 
 	return results, nil
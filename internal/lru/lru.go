@@ -0,0 +1,105 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Shard — LRU со своим локом; кеши делятся на такие шарды, чтобы воркеры
+// не упирались в один мьютекс. LRU двигается и на чтении, поэтому лок обычный,
+// а не RWMutex. Методы лок не берут — их вызывают под Lock.
+type Shard[K comparable, V any] struct {
+	sync.Mutex
+	items      map[K]*list.Element
+	order      *list.List // свежие спереди
+	maxEntries int        // 0 — без ограничения
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func NewShard[K comparable, V any](maxEntries int) *Shard[K, V] {
+	return &Shard[K, V]{
+		items:      make(map[K]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// PerShard делит общий лимит между shards шардами поровну (с округлением вверх)
+func PerShard(maxEntries, shards int) int {
+	if maxEntries <= 0 {
+		return 0
+	}
+	return (maxEntries + shards - 1) / shards
+}
+
+// Get — значение по ключу; найденный ключ становится самым свежим
+func (s *Shard[K, V]) Get(k K) (V, bool) {
+	el, ok := s.items[k]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	s.order.MoveToFront(el)
+	return el.Value.(*entry[K, V]).value, true
+}
+
+// Put записывает значение самым свежим и вытесняет самые давние сверх maxEntries.
+// added — ключа раньше не было; evicted — сколько вытеснено.
+func (s *Shard[K, V]) Put(k K, v V) (added bool, evicted int) {
+	if el, ok := s.items[k]; ok {
+		el.Value.(*entry[K, V]).value = v
+		s.order.MoveToFront(el)
+		return false, 0
+	}
+
+	s.items[k] = s.order.PushFront(&entry[K, V]{key: k, value: v})
+	if s.maxEntries > 0 {
+		for s.order.Len() > s.maxEntries {
+			old := s.order.Remove(s.order.Back()).(*entry[K, V])
+			delete(s.items, old.key)
+			evicted++
+		}
+	}
+	return true, evicted
+}
+
+// Remove убирает ключ; false — его не было
+func (s *Shard[K, V]) Remove(k K) bool {
+	el, ok := s.items[k]
+	if !ok {
+		return false
+	}
+	s.order.Remove(el)
+	delete(s.items, k)
+	return true
+}
+
+// Oldest — самый давний элемент, не трогая порядок
+func (s *Shard[K, V]) Oldest() (K, V, bool) {
+	el := s.order.Back()
+	if el == nil {
+		var (
+			k K
+			v V
+		)
+		return k, v, false
+	}
+	e := el.Value.(*entry[K, V])
+	return e.key, e.value, true
+}
+
+func (s *Shard[K, V]) Len() int {
+	return s.order.Len()
+}
+
+// Each обходит элементы от давних к свежим, не трогая порядок
+func (s *Shard[K, V]) Each(fn func(k K, v V)) {
+	for el := s.order.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*entry[K, V])
+		fn(e.key, e.value)
+	}
+}
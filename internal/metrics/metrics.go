@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "address_service"
+
+var (
+	// ----------- KAFKA CONSUMER -----------
+
+	MessagesConsumed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "raw_messages_consumed_total",
+		Help:      "Сырые сообщения, прочитанные из raw-топика",
+	})
+
+	MessagesDecoded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_decoded_total",
+		Help:      "Сообщения устройств, раскодированные из сырых payload'ов",
+	})
+
+	DecodeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decode_errors_total",
+		Help:      "Сырые payload'ы, которые не удалось раскодировать",
+	})
+
+	OffsetsPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "offsets_pending",
+		Help:      "Сырые сообщения партиции, ещё не закоммиченные: ждут подтверждения продюсера",
+	}, []string{"partition"})
+
+	CommitStuck = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "commit_stuck",
+		Help:      "1 — коммит партиции стоит: обогащённое сообщение не записалось и не ушло в DLQ",
+	}, []string{"partition"})
+
+	Undelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "undelivered_raw_messages_total",
+		Help:      "Сырые сообщения, чьи обогащённые не записались в Kafka: redelivered, dead_lettered, dropped (без DLQ)",
+	}, []string{"result"})
+
+	// ----------- USECASE -----------
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Текущая длина внутренних очередей (geo — сумма полос устройств, produce)",
+	}, []string{"queue"})
+
+	TriggerDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trigger_decisions_total",
+		Help:      "Решения триггера: hit — адрес из кеша, miss — нужен геокодер",
+	}, []string{"result"})
+
+	TriggerDevices = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "trigger_devices",
+		Help:      "Устройства в кеше реалтайм триггера",
+	})
+
+	TriggerEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trigger_evictions_total",
+		Help:      "Устройства, вытесненные из кеша триггера (ttl, capacity)",
+	}, []string{"reason"})
+
+	SpatialCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spatial_cache_requests_total",
+		Help:      "Обращения к общему geohash-кешу адресов (hit, miss)",
+	}, []string{"result"})
+
+	// ----------- GEOCODER -----------
+
+	GeocoderBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "geocoder_batch_duration_seconds",
+		Help:      "Время ответа геокодера на один батч",
+		Buckets:   []float64{.01, .025, .05, .1, .2, .3, .5, .8, 1, 2, 5},
+	})
+
+	GeocoderBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "geocoder_batch_size",
+		Help:      "Количество позиций в батче геокодера",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	GeocoderErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_errors_total",
+		Help:      "Батчи, на которых геокодер вернул ошибку",
+	})
+
+	GeocoderLengthMismatch = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_length_mismatch_total",
+		Help:      "Батчи, где ответ геокодера не сопоставился с позициями (длина или индексы)",
+	})
+
+	GeocoderItemErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_item_errors_total",
+		Help:      "Позиции, по которым геокодер вернул ошибку при успешном батче",
+	})
+
+	GeocoderCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_coalesced_positions_total",
+		Help:      "Позиции, не ушедшие в геокодер: дубль в батче или уже запрошены другим воркером",
+	})
+
+	GeocoderRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_rate_limited_positions_total",
+		Help:      "Позиции, не отправленные в геокодер из-за клиентской квоты (ушли с прошлым адресом)",
+	})
+
+	GeocoderHedges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_hedged_requests_total",
+		Help:      "Дубли медленных батчей на другую реплику geocache (sent) и сколько из них ответили первыми (won)",
+	}, []string{"result"})
+
+	GeocoderBatchLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "geocoder_batch_size_limit",
+		Help:      "Текущий размер батча геокодера, выбранный регулятором",
+	})
+
+	GeocoderParallelLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "geocoder_parallel_limit",
+		Help:      "Текущий предел батчей геокодера в полёте, выбранный регулятором",
+	})
+
+	GeocoderCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "geocoder_circuit_state",
+		Help:      "Состояние circuit breaker геокодера: 0 closed, 1 half-open, 2 open",
+	}, []string{"geocoder"})
+
+	// ----------- ENRICHMENT -----------
+
+	EnrichmentStatus = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "enrichment_status_total",
+		Help:      "Опубликованные сообщения по статусу адреса (fresh, cached, skipped_overload, failed, coordinates)",
+	}, []string{"status"})
+
+	Reenrich = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reenrich_total",
+		Help:      "Переобогащение пропущенных под нагрузкой: queued, requeued, dropped",
+	}, []string{"result"})
+
+	// ----------- KAFKA PRODUCER -----------
+
+	MessagesProduced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_produced_total",
+		Help:      "Обогащённые сообщения, отданные в Kafka writer",
+	})
+
+	ProducerCompletionErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "producer_completion_errors_total",
+		Help:      "Обогащённые сообщения, которые Kafka так и не приняла",
+	})
+
+	EndToEndDelay = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "end_to_end_delay_seconds",
+		Help:      "Задержка от серверного времени сообщения (ST) до отправки в enriched-топик",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 5, 10, 30, 60, 300},
+	})
+)